@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"snippet-box/pkg/forms"
+	"snippet-box/pkg/highlight"
+	"snippet-box/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The JSON API under /api/v1, used by editor plugins and bots. Its clients are authenticated by a personal API token,
+// never by the session cookie, so the API doesn't need CSRF tokens.
+// Every error is sent in the same envelope: {"error": {"code": "...", "message": "...", "fields": {"title": "..."}}}
+
+// The largest JSON request body accepted by the API, like the paste endpoint
+const maxAPIBodyBytes = maxPasteBytes
+
+// The JSON representation of a snippet. The files are left out of listings
+type apiSnippet struct {
+	Slug       string    `json:"slug"`
+	URL        string    `json:"url"`
+	UserID     int       `json:"user_id,omitempty"`
+	Title      string    `json:"title"`
+	Visibility string    `json:"visibility" enum:"public,unlisted,private"`
+	Files      []apiFile `json:"files,omitempty"`
+	MaxViews   int       `json:"max_views,omitempty"`
+	Views      int       `json:"views"`
+	Protected  bool      `json:"password_protected"`
+	Encrypted  bool      `json:"encrypted"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+}
+
+// The JSON representation of a file of a snippet
+type apiFile struct {
+	Name               string  `json:"name"`
+	Content            string  `json:"content"`
+	Language           string  `json:"language"`
+	LanguageConfidence float64 `json:"language_confidence"`
+}
+
+// The JSON representation of a user, without the password hash
+type apiUser struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Created time.Time `json:"created"`
+}
+
+// The body of a list response, with the cursors to give as "after" and "before" to read the next and previous pages
+type apiSnippetList struct {
+	Snippets []apiSnippet `json:"snippets"`
+	Next     string       `json:"next,omitempty"`
+	Prev     string       `json:"prev,omitempty"`
+}
+
+// The bodies of the responses holding a single snippet or user
+type (
+	apiSnippetBody struct {
+		Snippet apiSnippet `json:"snippet"`
+	}
+	apiUserBody struct {
+		User apiUser `json:"user"`
+	}
+)
+
+// The body of the create and update requests. The fields left out of an update keep their current value.
+// The omitempty options only mark the optional fields in the OpenAPI document
+type apiSnippetRequest struct {
+	Title       *string          `json:"title"`
+	Visibility  *string          `json:"visibility" enum:"public,unlisted,private"`
+	Files       []apiFileRequest `json:"files,omitempty"`
+	ExpiresDays *int             `json:"expires_days"`        // On update, 0 keeps the current expiry date
+	MaxViews    int              `json:"max_views,omitempty"` // Only on create, to burn the snippet after this many views
+	Password    string           `json:"password,omitempty"`  // Only on create
+	Encrypted   bool             `json:"encrypted,omitempty"` // Only on create, the files must then hold the ciphertext made by ui/static/js/main.js
+}
+
+// A file in a create or update request. A language left empty is detected, and "text" is plain text
+type apiFileRequest struct {
+	Name     string `json:"name,omitempty"`
+	Content  string `json:"content"`
+	Language string `json:"language,omitempty"`
+}
+
+// To convert a snippet to its JSON representation
+func newAPISnippet(r *http.Request, s *models.Snippet) apiSnippet {
+	out := apiSnippet{
+		Slug:       s.Slug,
+		URL:        baseURL(r) + "/snippet/" + s.Slug,
+		UserID:     s.UserID,
+		Title:      s.Title,
+		Visibility: s.Visibility,
+		MaxViews:   s.MaxViews,
+		Views:      s.Views,
+		Protected:  s.Protected(),
+		Encrypted:  s.Encrypted,
+		Created:    s.Created,
+		Expires:    s.Expires,
+	}
+	for _, f := range s.Files {
+		out.Files = append(out.Files, apiFile{f.Name, f.Content, f.Language, f.LanguageConfidence})
+	}
+	return out
+}
+
+// To convert a page of snippets to its JSON representation
+func newAPISnippetList(r *http.Request, page *models.SnippetPage) apiSnippetList {
+	out := apiSnippetList{Snippets: []apiSnippet{}}
+	for _, s := range page.Snippets {
+		out.Snippets = append(out.Snippets, newAPISnippet(r, s))
+	}
+	if page.Next != nil {
+		out.Next = page.Next.Encode()
+	}
+	if page.Prev != nil {
+		out.Prev = page.Prev.Encode()
+	}
+	return out
+}
+
+// To send a value as JSON with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	// To encode the value first, so an error can still be sent as a 500 response
+	js, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// The error envelope of the API
+type apiErrorBody struct {
+	Error struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Fields  map[string]string `json:"fields,omitempty"`
+	} `json:"error"`
+}
+
+// To send an error in the envelope of the API. The code is a stable identifier for programs, the message is for humans
+func apiError(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	var body apiErrorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	body.Error.Fields = fields
+	writeJSON(w, status, body)
+}
+
+// The API version of the serverError helper, the error is logged with its stack trace and hidden from the client
+func (app *application) apiServerError(w http.ResponseWriter, err error) {
+	if app.clientGone(w, err) {
+		return
+	}
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+	if errors.Is(err, context.DeadlineExceeded) {
+		apiError(w, http.StatusServiceUnavailable, "unavailable", "The database took too long to answer, try again later", nil)
+		return
+	}
+	apiError(w, http.StatusInternalServerError, "internal_error", "The server encountered a problem", nil)
+}
+
+// The API version of the notFound helper
+func apiNotFound(w http.ResponseWriter) {
+	apiError(w, http.StatusNotFound, "not_found", "The requested resource could not be found", nil)
+}
+
+// The names of the form fields in the API, e.g. the "content.0" form field is "files[0].content"
+var (
+	fileFieldRx   = regexp.MustCompile(`^(file_name|content|language)\.(\d+)$`)
+	apiFieldNames = map[string]string{"expires": "expires_days", "views": "max_views", "file_name": "name"}
+)
+
+// To send the errors of an invalid body form as field errors named after the JSON fields of the request, with a 422
+// status
+func apiFormError(w http.ResponseWriter, form *forms.Form) {
+	fields := map[string]string{}
+	for field := range form.Errors {
+		name := field
+		if m := fileFieldRx.FindStringSubmatch(field); m != nil {
+			inner := m[1]
+			if n, ok := apiFieldNames[inner]; ok {
+				inner = n
+			}
+			name = fmt.Sprintf("files[%s].%s", m[2], inner)
+		} else if n, ok := apiFieldNames[field]; ok {
+			name = n
+		}
+		fields[name] = form.Errors.Get(field)
+	}
+	apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fields)
+}
+
+// To send the errors of invalid query string values as field errors named after the query parameters, with a 422
+// status. Unlike the body forms, the query strings of the API and of the pages use the same names
+func apiQueryError(w http.ResponseWriter, form *forms.Form) {
+	fields := map[string]string{}
+	for field := range form.Errors {
+		fields[field] = form.Errors.Get(field)
+	}
+	apiError(w, http.StatusUnprocessableEntity, "validation_failed", "Some query parameters are invalid", fields)
+}
+
+// To decode the JSON body of a request into dst, sending the error response itself and returning false when it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("the body must only hold a single JSON value")
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apiError(w, http.StatusRequestEntityTooLarge, "body_too_large", "The request body is too large", nil)
+		return false
+	} else if err != nil {
+		apiError(w, http.StatusBadRequest, "bad_request", "The request body is invalid: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// To make sure the request is authenticated by an API token, sending a 401 error and returning nil otherwise
+func (app *application) apiUser(w http.ResponseWriter, r *http.Request) *models.User {
+	user := app.authenticatedUser(r)
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		apiError(w, http.StatusUnauthorized, "unauthorized", "This needs an API token in the Authorization header", nil)
+	}
+	return user
+}
+
+// To fetch the snippet from the ":slug" in the URL with the visibility rules of snippetFromURL, sending the error
+// response itself and returning false when the snippet can't be used
+func (app *application) apiSnippetFromURL(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, err := app.snippets.GetBySlug(r.Context(), r.URL.Query().Get(":slug"), app.viewerID(r))
+	if err == models.ErrNoRecord {
+		apiNotFound(w)
+		return nil, false
+	} else if err != nil {
+		app.apiServerError(w, err)
+		return nil, false
+	}
+	return s, true
+}
+
+// To fetch the snippet from the ":slug" in the URL, making sure it belongs to the authenticated user
+func (app *application) apiOwnedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	user := app.apiUser(w, r)
+	if user == nil {
+		return nil, false
+	}
+	s, ok := app.apiSnippetFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if !s.OwnedBy(user.ID) {
+		apiError(w, http.StatusForbidden, "forbidden", "Only the author of a snippet can change it", nil)
+		return nil, false
+	}
+	return s, true
+}
+
+// To fill in the fields of a snippet form from the body of a create or update request
+func (req *apiSnippetRequest) setForm(form *forms.Form) {
+	if req.Title != nil {
+		form.Set("title", *req.Title)
+	}
+	if req.Visibility != nil {
+		form.Set("visibility", *req.Visibility)
+	}
+	if req.ExpiresDays != nil {
+		form.Set("expires", strconv.Itoa(*req.ExpiresDays))
+	}
+	if req.Files != nil {
+		files := make([]fileField, len(req.Files))
+		for i, f := range req.Files {
+			files[i] = fileField{Index: i, Name: strings.TrimSpace(f.Name), Content: f.Content, Language: f.Language}
+			switch f.Language {
+			case "":
+				files[i].Language = highlight.AutoDetect
+			case "text":
+				files[i].Language = ""
+			}
+		}
+		setFormFiles(form, files)
+	}
+}
+
+// GET /api/v1/snippets, to list the snippets with the same filters and cursors as the home page
+func (app *application) apiListSnippets(w http.ResponseWriter, r *http.Request) {
+	filter, form := snippetFilter(r)
+	if !form.Valid() {
+		apiQueryError(w, form)
+		return
+	}
+	filter.ViewerID = app.viewerID(r)
+
+	page, err := app.snippets.List(r.Context(), filter)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPISnippetList(r, page))
+}
+
+// GET /api/v1/snippets/:slug, to read a snippet with its files. This counts as a view, like showing the snippet page.
+// The password of a protected snippet is given in the X-Snippet-Password header
+func (app *application) apiShowSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.apiSnippetFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if app.needsPassword(r, s) {
+		if !app.unlockAttempts.Allow(s.Slug) {
+			apiError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many failed attempts, please try again later", nil)
+			return
+		}
+		err := s.CheckPassword(r.Header.Get("X-Snippet-Password"))
+		if err == models.ErrInvalidCredentials {
+			apiError(w, http.StatusForbidden, "password_required", "The X-Snippet-Password header is missing or wrong", nil)
+			return
+		} else if err != nil {
+			app.apiServerError(w, err)
+			return
+		}
+		app.unlockAttempts.Succeed(s.Slug)
+	}
+
+	s, err := app.snippets.View(r.Context(), s.Slug, app.viewerID(r))
+	if err == models.ErrNoRecord {
+		apiNotFound(w)
+		return
+	} else if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiSnippetBody{newAPISnippet(r, s)})
+}
+
+// POST /api/v1/snippets, to create a snippet owned by the authenticated user, with the validation of the create form
+func (app *application) apiCreateSnippet(w http.ResponseWriter, r *http.Request) {
+	user := app.apiUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req apiSnippetRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	// The defaults are the ones of the create form
+	form := forms.New(url.Values{"visibility": {models.VisibilityPublic}, "expires": {"365"}})
+	req.setForm(form)
+	if req.MaxViews > 0 {
+		form.Set("expires", "burn")
+		form.Set("views", strconv.Itoa(req.MaxViews))
+	}
+	form.Set("password", req.Password)
+	if req.Encrypted {
+		form.Set("encrypted", "true")
+	}
+
+	validateCreateForm(form)
+	if !form.Valid() {
+		apiFormError(w, form)
+		return
+	}
+
+	s, expires, err := newSnippet(form, user.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	slug, err := app.snippets.Insert(r.Context(), s, expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	// The owner's views aren't counted, so reading the new snippet back doesn't burn it
+	s, err = app.snippets.GetBySlug(r.Context(), slug, user.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/snippets/"+slug)
+	writeJSON(w, http.StatusCreated, apiSnippetBody{newAPISnippet(r, s)})
+}
+
+// PATCH /api/v1/snippets/:slug, to change the title, visibility, files or expiry date of a snippet of the authenticated
+// user, with the validation of the edit form
+func (app *application) apiUpdateSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var req apiSnippetRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	// The fields left out of the request keep their current value
+	form := forms.New(url.Values{"title": {s.Title}, "visibility": {s.Visibility}, "expires": {"0"}})
+	setFormFiles(form, fileFields(s.Files))
+	req.setForm(form)
+
+	validateSnippetForm(form, s.Encrypted, "0", "365", "7", "1")
+	if !form.Valid() {
+		apiFormError(w, form)
+		return
+	}
+
+	expires, _ := strconv.Atoi(form.Get("expires"))
+	s.Title = form.Get("title")
+	s.Files = filesFromForm(form, s.Encrypted)
+	s.Visibility = form.Get("visibility")
+
+	err := app.snippets.Update(r.Context(), s, s.UserID, expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	s, err = app.snippets.GetBySlug(r.Context(), s.Slug, s.UserID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiSnippetBody{newAPISnippet(r, s)})
+}
+
+// DELETE /api/v1/snippets/:slug, to delete a snippet of the authenticated user
+func (app *application) apiDeleteSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.apiOwnedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), s.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/v1/user, to read the authenticated user
+func (app *application) apiShowUser(w http.ResponseWriter, r *http.Request) {
+	user := app.apiUser(w, r)
+	if user == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiUserBody{apiUser{ID: user.ID, Name: user.Name, Email: user.Email, Created: user.Created}})
+}
@@ -1,71 +1,114 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"html/template"
-	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"snippet-box/pkg/forms"
+	"snippet-box/pkg/highlight"
 	"snippet-box/pkg/models"
 	"strconv"
+	"strings"
 )
 
-// Changed the signature of the home handler so it is defined as a method against the application
+// Changed the signature of the home handler so it is defined as a method against the application.
+// The listing can also be sent as JSON, like the API sends it, or as plain text with a URL and title per line
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
+	format := negotiate(w, r, mediaHTML, mediaJSON, mediaText)
 
-	s, err := app.snippets.Latest()
+	// To read the filters from the query string, redisplaying the form if any of them is invalid
+	filter, form := snippetFilter(r)
+	if !form.Valid() {
+		switch format {
+		case mediaJSON:
+			apiQueryError(w, form)
+		case mediaText:
+			writeFormErrors(w, form)
+		default:
+			app.render(w, r, "home.page.tmpl", &templateData{Form: form})
+		}
+		return
+	}
+	filter.ViewerID = app.viewerID(r)
+
+	page, err := app.snippets.List(r.Context(), filter)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// for _, snippet := range s {
-	// 	fmt.Fprintf(w, "%v\n", snippet)
-	// }
+	switch format {
+	case mediaJSON:
+		writeJSON(w, http.StatusOK, newAPISnippetList(r, page))
+		return
+	case mediaText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, s := range page.Snippets {
+			fmt.Fprintf(w, "%s/snippet/%s\t%s\n", baseURL(r), s.Slug, s.Title)
+		}
+		return
+	}
+
+	// To render the home page with the snippets and the links to the pages around them
+	app.render(w, r, "home.page.tmpl", &templateData{
+		Form:       form,
+		Pagination: newCursorPagination(r, page),
+		Snippets:   page.Snippets,
+	})
+}
 
-	// To create an instance of a templateData struct holding the slice of snippets
-	data := &templateData{Snippets: s}
+// Changed the signature of the showSnippet handler so it is defined as a method against *application & // To show snippet.
+// The snippet can also be sent as JSON, like the API sends it, or its files as plain text
+func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
+	format := negotiate(w, r, mediaHTML, mediaJSON, mediaText)
 
-	// To initialize a slice containing the paths to the two files
-	files := []string{
-		"./ui/html/home.page.tmpl",
-		"./ui/html/base.layout.tmpl",
-		"./ui/html/footer.partial.tmpl",
+	// Old links used the integer ID of the snippet, they are redirected to the slug URL when the snippet was public
+	// (or belongs to the viewer), so unlisted snippets can't be found by counting IDs
+	if id, err := strconv.Atoi(r.URL.Query().Get(":slug")); err == nil {
+		app.redirectLegacySnippet(w, r, id)
+		return
 	}
 
-	// To read the template file & store it in a template set
-	ts, err := template.ParseFiles(files...)
+	// To fetch the snippet data from the DB, as long as the current user is allowed to see it. The errors are sent in
+	// the negotiated format, so the clients asking for JSON always get the envelope of the API
+	s, err := app.snippets.GetBySlug(r.Context(), r.URL.Query().Get(":slug"), app.viewerID(r))
 	if err != nil {
-		app.serverError(w, err)
+		app.snippetError(w, format, err)
 		return
 	}
 
-	// To write the template content as the response body
-	err = ts.Execute(w, data) // second parameter is the data to be pass in i.e templateData
-	if err != nil {
-		log.Println(err.Error())
-		http.Error(w, "Internal Server Error", 500)
+	// A password protected snippet shows the unlock form until the password has been given in this session, the
+	// other formats are refused like the raw endpoints do
+	if app.locked(r, s) {
+		if format != mediaHTML {
+			app.negotiatedError(w, format, http.StatusForbidden, "password_required",
+				"The snippet is password protected, unlock it on its page first")
+			return
+		}
+		app.render(w, r, "unlock.page.tmpl", &templateData{Form: forms.New(nil), Snippet: s})
+		return
+	}
+	// The files of an encrypted snippet can only be decrypted in the browser, there is no plain text to send
+	if format == mediaText && s.Encrypted {
+		app.clientError(w, http.StatusNotAcceptable)
+		return
 	}
-}
 
-// Changed the signature of the showSnippet handler so it is defined as a method against *application & // To show snippet
-func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
-	//  To extract the ID from the URL path
-	idStr := r.URL.Path[len("/snippet/"):]
-	// To convert to int
-	id, err := strconv.Atoi(idStr)
-	if err != nil || id < 1 {
-		app.notFound(w)
+	// To read the snippet content, this counts as a view which deletes a burn after reading snippet when it is its last one
+	s, err = app.snippets.View(r.Context(), s.Slug, app.viewerID(r))
+	if err != nil {
+		app.snippetError(w, format, err)
 		return
 	}
 
-	// To fetch the snippet data from the DB
-	s, err := app.snippets.Get(id)
-	if err == models.ErrNoRecord {
-		app.notFound(w)
+	switch format {
+	case mediaJSON:
+		writeJSON(w, http.StatusOK, apiSnippetBody{newAPISnippet(r, s)})
 		return
-	} else if err != nil {
-		app.serverError(w, err)
+	case mediaText:
+		writeFiles(w, s.Files)
 		return
 	}
 
@@ -73,35 +116,34 @@ func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "show.page.tmpl", &templateData{
 		Snippet: s,
 	})
+}
 
-	// To create an instance of a templateData struct holding the snippet data
-	data := &templateData{Snippet: s}
+// To redirect an old integer snippet URL to its slug URL
+func (app *application) redirectLegacySnippet(w http.ResponseWriter, r *http.Request, id int) {
+	viewerID := app.viewerID(r)
 
-	// To initialize a slice containing the paths to the template files
-	files := []string{
-		"./ui/html/show.page.tmpl",
-		"./ui/html/base.layout.tmpl",
-		"./ui/html/footer.partial.tmpl",
-	}
-
-	// To load the templates from the file paths
-	ts, err := template.ParseFiles(files...)
-	if err != nil {
+	s, err := app.snippets.Get(r.Context(), id, viewerID)
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
-	// To execute the template set
-	err = ts.Execute(w, data)
-	if err != nil {
-		app.serverError(w, err)
+
+	if s.Visibility != models.VisibilityPublic && !s.OwnedBy(viewerID) {
+		app.notFound(w)
+		return
 	}
+
+	http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusMovedPermanently)
 }
 
 // To render the snippet form page
 func (app *application) createSnippetForm(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "create.page.tmpl", &templateData{
-		// To pass a new empty forms.forms object to the templte
-		Form: forms.New(nil),
+		// To pass a new forms.forms object to the templte with a single file, its language is detected unless the user picks one
+		Form: forms.New(url.Values{"language": {highlight.AutoDetect}}),
 	})
 }
 
@@ -115,31 +157,31 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// To create a new forms.Form struct containing the POSTed data from the form, and using the validation method to check the content
+	// To create a new forms.Form struct containing the POSTed data from the form
 	form := forms.New(r.PostForm)
-	form.Required("title", "content", "expires")
-	form.MaxLength("title", 100)
-	form.PermittedValues("expires", "367", "7", "1")
+
+	// Adding or removing a file only redisplays the form
+	if changeFormFiles(form) {
+		app.render(w, r, "create.page.tmpl", &templateData{Form: form})
+		return
+	}
 
 	// If the form isn't valid, redisplay the template passing in the form.Form object as the data
+	validateCreateForm(form)
 	if !form.Valid() {
 		app.render(w, r, "create.page.tmpl", &templateData{Form: form})
 		return
 	}
 
-	// To retrieve the validated fields values from the form
-	title := form.Get("title")
-	content := form.Get("content")
-	expiresStr := form.Get("expires")
-	//To convert expires to int
-	expires, err := strconv.Atoi(expiresStr)
+	// To retrieve the validated fields values from the form, the snippet is owned by the logged in user
+	s, expires, err := newSnippet(form, app.authenticatedUser(r).ID)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.serverError(w, err)
 		return
 	}
 
 	// To insert the snippet validated data in the DB
-	id, err := app.snippets.Insert(title, content, expires)
+	slug, err := app.snippets.Insert(r.Context(), s, expires)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -149,7 +191,342 @@ func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
 	app.session.Put(r, "flash", "Snippet successfully created!")
 
 	// To redirect the user to the relevant page of the snippet using semantic URL style
-	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, "/snippet/"+slug, http.StatusSeeOther)
+}
+
+// To create a snippet from the command line, e.g. `go test ./... 2>&1 | curl --data-binary @- https://host/paste`.
+// The request body is the content of the snippet, or a multipart form with "file" uploads and "content" values, one per
+// file (`curl -F file=@main.go -F file=@go.mod`). The other fields of the create form can be given in the query string
+// or in the multipart form. The snippet is anonymous unless a personal API token is given in the Authorization header.
+// The response is the URL of the new snippet, as plain text
+func (app *application) pasteSnippet(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasteBytes)
+	form, err := pasteForm(r)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// An anonymous snippet has no owner, so nobody could ever read it if it was private
+	userID := app.viewerID(r)
+	if userID == 0 && form.Get("visibility") == models.VisibilityPrivate {
+		form.Errors.Add("visibility", "An anonymous snippet can't be private")
+	}
+	validateCreateForm(form)
+	if !form.Valid() {
+		writeFormErrors(w, form)
+		return
+	}
+
+	s, expires, err := newSnippet(form, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	slug, err := app.snippets.Insert(r.Context(), s, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	link := baseURL(r) + "/snippet/" + slug
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Location", link)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, link)
+}
+
+// To render the edit form of a snippet, pre-filled with its current title and files
+func (app *application) editSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{
+		"title":      {s.Title},
+		"visibility": {s.Visibility},
+		"expires":    {"0"},
+	})
+	setFormFiles(form, fileFields(s.Files))
+
+	app.render(w, r, "edit.page.tmpl", &templateData{Form: form, Snippet: s})
+}
+
+// To save the changes made to a snippet by its owner
+func (app *application) editSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	if changeFormFiles(form) {
+		app.render(w, r, "edit.page.tmpl", &templateData{Form: form, Snippet: s})
+		return
+	}
+
+	// The same validation as when creating, plus "0" to keep the current expiry date
+	validateSnippetForm(form, s.Encrypted, "0", "365", "7", "1")
+
+	if !form.Valid() {
+		app.render(w, r, "edit.page.tmpl", &templateData{Form: form, Snippet: s})
+		return
+	}
+
+	expires, err := strconv.Atoi(form.Get("expires"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.Title = form.Get("title")
+	s.Files = filesFromForm(form, s.Encrypted)
+	s.Visibility = form.Get("visibility")
+
+	err = app.snippets.Update(r.Context(), s, app.authenticatedUser(r).ID, expires)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusSeeOther)
+}
+
+// To delete a snippet owned by the logged in user
+func (app *application) deleteSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+// To show the revisions of a snippet and the diff between two of them, chosen with the "from" and "to" query string values
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.snippetFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The revisions show the content, so only the owner can see those of a burn after reading snippet
+	if s.MaxViews > 0 && !s.OwnedBy(app.viewerID(r)) {
+		app.notFound(w)
+		return
+	}
+	// and a password protected snippet must be unlocked first
+	if app.locked(r, s) {
+		http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusSeeOther)
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(r.Context(), s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// By default compare the latest revision with the one before it
+	var from, to *models.Revision
+	if n := len(revisions); n > 0 {
+		from, to = revisions[max(n-2, 0)], revisions[n-1]
+	}
+	if rev := findRevision(revisions, r.URL.Query().Get("from")); rev != nil {
+		from = rev
+	}
+	if rev := findRevision(revisions, r.URL.Query().Get("to")); rev != nil {
+		to = rev
+	}
+
+	// The server can't diff the ciphertext of an encrypted snippet in any useful way
+	data := &templateData{Snippet: s, Revisions: revisions}
+	if from != nil && to != nil && !s.Encrypted {
+		data.Diff = &revisionDiff{
+			From:  from,
+			To:    to,
+			Files: diffFiles(from.Files, to.Files),
+		}
+	}
+
+	app.render(w, r, "history.page.tmpl", data)
+}
+
+// To download all the files of a snippet as a zip archive, this counts as a view like showing the snippet
+func (app *application) downloadZip(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeZip(w, s)
+}
+
+// To download a snippet, as a file named after its title and language, or as a zip archive when it has several files
+func (app *application) downloadSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if len(s.Files) != 1 {
+		app.writeZip(w, s)
+		return
+	}
+	ext := highlight.Extension(s.Files[0].Language)
+	writeFile(w, "attachment", downloadName(s, ext)+ext, s.Files[0].Content)
+}
+
+// To show the first file of a snippet as plain text, e.g. to pipe it into a shell with curl
+func (app *application) rawSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewedSnippet(w, r)
+	if !ok {
+		return
+	}
+	if len(s.Files) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	writeFile(w, "inline", s.Files[0].Name, s.Files[0].Content)
+}
+
+// To show one file of a snippet as plain text, the file is found by the ":file" name in the URL
+func (app *application) rawFile(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.viewedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// viewedSnippet checked the file before counting the view, but an edit may have removed it since
+	f := s.File(r.URL.Query().Get(":file"))
+	if f == nil {
+		app.notFound(w)
+		return
+	}
+	writeFile(w, "inline", f.Name, f.Content)
+}
+
+// To check the password of a protected snippet, and remember in the session that it has been unlocked
+func (app *application) unlockSnippet(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.snippetFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// A snippet without a password, or one of the user's own, has nothing to unlock
+	if !app.needsPassword(r, s) {
+		http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	// To stop password guessing, each snippet only allows a few failed attempts in a row. The attempt is recorded by
+	// Allow, before the slow password check, so parallel guesses are limited too
+	if !app.unlockAttempts.Allow(s.Slug) {
+		form.Errors.Add("generic", "Too many failed attempts, please try again later")
+		app.render(w, r, "unlock.page.tmpl", &templateData{Form: form, Snippet: s})
+		return
+	}
+
+	err = s.CheckPassword(form.Get("password"))
+	if err == models.ErrInvalidCredentials {
+		form.Errors.Add("generic", "The password is incorrect")
+		app.render(w, r, "unlock.page.tmpl", &templateData{Form: form, Snippet: s})
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.unlockAttempts.Succeed(s.Slug)
+	app.session.Put(r, unlockedKey(s), true)
+
+	http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusSeeOther)
+}
+
+// To restore an old revision of a snippet, which saves its title and files as a new revision
+func (app *application) restoreRevision(w http.ResponseWriter, r *http.Request) {
+	s, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.snippets.Revisions(r.Context(), s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	rev := findRevision(revisions, r.URL.Query().Get(":rev"))
+	if rev == nil {
+		app.notFound(w)
+		return
+	}
+
+	s.Title = rev.Title
+	s.Files = rev.Files
+
+	err = app.snippets.Update(r.Context(), s, app.authenticatedUser(r).ID, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Revision successfully restored!")
+
+	http.Redirect(w, r, "/snippet/"+s.Slug, http.StatusSeeOther)
+}
+
+// To search the snippets for the "q" query string value
+func (app *application) searchSnippets(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		app.render(w, r, "search.page.tmpl", &templateData{})
+		return
+	}
+
+	page := pageParam(r)
+
+	s, err := app.snippets.Search(r.Context(), query, app.viewerID(r), snippetsPerPage+1, (page-1)*snippetsPerPage)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "search.page.tmpl", &templateData{
+		Query:      query,
+		Pagination: newPagination(r, page, len(s) > snippetsPerPage),
+		Snippets:   s[:min(len(s), snippetsPerPage)],
+	})
 }
 
 // For Authentication
@@ -180,7 +557,7 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// To create a new user record in the DB, show err if the user exist
-	err = app.users.Insert(form.Get("name"), form.Get("email"), form.Get("password"))
+	err = app.users.Insert(r.Context(), form.Get("name"), form.Get("email"), form.Get("password"))
 	if err == models.ErrDuplicateEmail {
 		form.Errors.Add("email", "Address is already in use")
 		app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
@@ -212,7 +589,7 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 
 	// To check if the credentials are valid
 	form := forms.New(r.PostForm)
-	id, err := app.users.Authenticate(form.Get("email"), form.Get("password"))
+	id, err := app.users.Authenticate(r.Context(), form.Get("email"), form.Get("password"))
 	if err == models.ErrInvalidCredentials {
 		form.Errors.Add("generic", "Email or Password is incorrect!")
 		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
@@ -223,7 +600,7 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// To add the id of the current user to the session to make the user logged in
-	app.session.Put(r, "userId", id)
+	app.session.Put(r, "userID", id)
 
 	// To redirect the user to the create snippet page
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
@@ -236,3 +613,136 @@ func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
 	app.session.Put(r, "flash", "You've been logged out successfully!")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// To list the snippets created by the logged in user
+func (app *application) mySnippets(w http.ResponseWriter, r *http.Request) {
+	app.renderUserSnippets(w, r, app.authenticatedUser(r))
+}
+
+// To list the snippets created by any user, using the ":id" from the URL
+func (app *application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	owner, err := app.users.Get(r.Context(), id)
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderUserSnippets(w, r, owner)
+}
+
+// To render one page of a user's snippets
+func (app *application) renderUserSnippets(w http.ResponseWriter, r *http.Request, owner *models.User) {
+	filter, form := snippetFilter(r)
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	filter.UserID = owner.ID
+	filter.ViewerID = app.viewerID(r)
+
+	page, err := app.snippets.List(r.Context(), filter)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "snippets.page.tmpl", &templateData{
+		Owner:      owner,
+		Pagination: newCursorPagination(r, page),
+		Snippets:   page.Snippets,
+	})
+}
+
+// To list the personal API tokens of the logged in user, with the form to create a new one
+func (app *application) listTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, forms.New(url.Values{"scopes": {models.ScopeRead}}), "")
+}
+
+// To create a new personal API token for the logged in user. The token is only shown once, in the response to this
+// request, as only its hash is kept
+func (app *application) createToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", 100)
+	scopes := form.Values["scopes"]
+	if len(scopes) == 0 {
+		form.Errors.Add("scopes", "Pick at least one scope")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			form.Errors.Add("scopes", "This field is invalid")
+			break
+		}
+	}
+	if !form.Valid() {
+		app.renderTokens(w, r, form, "")
+		return
+	}
+
+	token, err := app.tokens.Insert(r.Context(), app.authenticatedUser(r).ID, form.Get("name"), scopes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.renderTokens(w, r, forms.New(url.Values{"scopes": {models.ScopeRead}}), token)
+}
+
+// To revoke one of the personal API tokens of the logged in user, the requests made with it are refused from then on
+func (app *application) revokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.tokens.Revoke(r.Context(), id, app.authenticatedUser(r).ID)
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Token successfully revoked!")
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
+// To render the API tokens page with the token form, and the token just created if there is one
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, form *forms.Form, token string) {
+	tokens, err := app.tokens.ByUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "tokens.page.tmpl", &templateData{
+		Form:     form,
+		PasteURL: baseURL(r) + "/paste",
+		Scopes:   models.Scopes,
+		Token:    token,
+		Tokens:   tokens,
+	})
+}
+
+// To serve the stylesheet of the syntax highlighting themes, generated once at startup
+func (app *application) highlightStylesheet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Write([]byte(app.highlightCSS))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"snippet-box/pkg/diff"
+	"snippet-box/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestUnlockUnprotectedSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	slug := newTestSnippet(t, app, &models.Snippet{})
+
+	r := httptest.NewRequest(http.MethodPost, "/snippet/"+slug+"/unlock?:slug="+slug, strings.NewReader(url.Values{"password": {"guess"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	app.session.Enable(http.HandlerFunc(app.unlockSnippet)).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("got status %d, want %d", rr.Code, http.StatusSeeOther)
+	}
+	if got := rr.Header().Get("Location"); got != "/snippet/"+slug {
+		t.Errorf("got a redirect to %q, want /snippet/%s", got, slug)
+	}
+}
+
+func TestRawFileMissing(t *testing.T) {
+	app := newTestApplication(t)
+	slug := newTestSnippet(t, app, &models.Snippet{MaxViews: 1})
+
+	res := send(t, app.routes(), http.MethodGet, "/snippet/"+slug+"/raw/missing.go", "", "", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+
+	// The request for the missing file didn't use up the only view of the snippet
+	res = send(t, app.routes(), http.MethodGet, "/snippet/"+slug+"/raw/main.go", "", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for the existing file, want %d", res.StatusCode, http.StatusOK)
+	}
+}
+
+// A SnippetStore whose snippets lose their files when they are viewed, like after an edit made between the check
+// of a file and the view
+type editedSnippets struct {
+	models.SnippetStore
+}
+
+func (e *editedSnippets) View(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	s, err := e.SnippetStore.View(ctx, slug, viewerID)
+	if s != nil {
+		s.Files = nil
+	}
+	return s, err
+}
+
+func TestRawFileRemovedBeforeView(t *testing.T) {
+	app := newTestApplication(t)
+	slug := newTestSnippet(t, app, &models.Snippet{})
+	app.snippets = &editedSnippets{app.snippets}
+
+	res := send(t, app.routes(), http.MethodGet, "/snippet/"+slug+"/raw/main.go", "", "", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestSnippetHistoryTooLargeDiff(t *testing.T) {
+	app := newTestApplication(t)
+	var old, new strings.Builder
+	for i := 0; i < diff.MaxLines; i++ {
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&new, "new %d\n", i)
+	}
+	slug := newTestSnippet(t, app, &models.Snippet{Files: []*models.File{{Name: "big.txt", Content: old.String()}}})
+	s, err := app.snippets.GetBySlug(context.Background(), slug, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Files = []*models.File{{Name: "big.txt", Content: new.String()}}
+	if err = app.snippets.Update(context.Background(), s, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	res := send(t, app.routes(), http.MethodGet, "/snippet/"+slug+"/history", "", "", nil)
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if !strings.Contains(string(body), "The file is too large to diff.") {
+		t.Errorf("the history page doesn't say the file is too large to diff")
+	}
+}
+
+func TestAPIFieldErrorNames(t *testing.T) {
+	app := newTestApplication(t)
+	owner := newTestUser(t, app, "owner@example.com")
+	token := newTestToken(t, app, owner, models.ScopeWrite)
+	acceptJSON := http.Header{"Accept": {"application/json"}}
+
+	// The list filters keep the names of the query parameters, the body fields are named as in the JSON requests
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		header http.Header
+		field  string
+	}{
+		{"API list filter", http.MethodGet, "/api/v1/snippets?expires=0", "", "", nil, "expires"},
+		{"home page filter as JSON", http.MethodGet, "/?expires=0", "", "", acceptJSON, "expires"},
+		{
+			"API body", http.MethodPost, "/api/v1/snippets", token,
+			`{"title": "Test", "files": [{"content": "x"}], "expires_days": 0}`, nil, "expires_days",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := send(t, app.routes(), tt.method, tt.path, tt.token, tt.body, tt.header)
+			if res.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusUnprocessableEntity)
+			}
+			var body apiErrorBody
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := body.Error.Fields[tt.field]; !ok || len(body.Error.Fields) != 1 {
+				t.Errorf("got the field errors %v, want one for %q", body.Error.Fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestShowSnippetErrorFormats(t *testing.T) {
+	app := newTestApplication(t)
+	protected := newTestSnippet(t, app, &models.Snippet{HashedPassword: []byte("$2a$04$hash")})
+	encrypted := newTestSnippet(t, app, &models.Snippet{Encrypted: true})
+
+	tests := []struct {
+		name        string
+		slug        string
+		accept      string
+		status      int
+		contentType string
+		code        string // The code of the JSON error envelope
+	}{
+		{"locked as JSON", protected, "application/json", http.StatusForbidden, "application/json", "password_required"},
+		{"missing as JSON", "missing123", "application/json", http.StatusNotFound, "application/json", "not_found"},
+		{"locked as text", protected, "text/plain", http.StatusForbidden, "text/plain; charset=utf-8", ""},
+		{"encrypted as text", encrypted, "text/plain", http.StatusNotAcceptable, "text/plain; charset=utf-8", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := send(t, app.routes(), http.MethodGet, "/snippet/"+tt.slug, "", "", http.Header{"Accept": {tt.accept}})
+			if res.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", res.StatusCode, tt.status)
+			}
+			if got := res.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got content type %q, want %q", got, tt.contentType)
+			}
+			if tt.code == "" {
+				return
+			}
+			var body apiErrorBody
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.code {
+				t.Errorf("got the error code %q, want %q", body.Error.Code, tt.code)
+			}
+		})
+	}
+}
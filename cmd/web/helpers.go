@@ -1,35 +1,120 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
 	"runtime/debug"
+	"snippet-box/pkg/forms"
+	"snippet-box/pkg/highlight"
 	"snippet-box/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/justinas/nosurf"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// The serverError helper writes an error message and stack trace to the errorLog and sends 500 Error response to the user
+// The serverError helper writes an error message and stack trace to the errorLog and sends 500 Error response to the user.
+// A database call which didn't finish in time is answered with 503 instead, as the request can be tried again later
 func (app *application) serverError(w http.ResponseWriter, err error) {
+	if app.clientGone(w, err) {
+		return
+	}
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
 	// To report is the file name and line number one step back in the stack trace,
 	app.errorLog.Output(2, trace)
 
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// The status of the requests given up by their client before the response, as nginx logs them. The client never sees it
+const statusClientClosedRequest = 499
+
+// To check if err comes from the client giving up on the request, e.g. by closing the page, which cancels its context
+// along with the database call. It isn't a problem of the server, so it is only noted in the infoLog and the
+// response gets the 499 status nobody reads, rather than a 5xx one
+func (app *application) clientGone(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, context.Canceled) {
+		return false
+	}
+	app.infoLog.Printf("The client closed the request: %s", err)
+	w.WriteHeader(statusClientClosedRequest)
+	return true
+}
+
 // This sends a 400 Error when theres is a Bad Request from the user
 func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// This sends a 401 Error when the API token of the request is wrong, asking for a bearer token.
+// The requests to the JSON API get the error in its envelope
+func (app *application) unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		apiError(w, http.StatusUnauthorized, "unauthorized", "The API token is invalid", nil)
+		return
+	}
+	app.clientError(w, http.StatusUnauthorized)
+}
+
+// This sends a 403 Error when the API token of the request wasn't given the scope the request needs
+func (app *application) insufficientScope(w http.ResponseWriter, r *http.Request, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		apiError(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("The API token needs the %q scope", scope), nil)
+		return
+	}
+	http.Error(w, fmt.Sprintf("The API token needs the %q scope", scope), http.StatusForbidden)
+}
+
 // This sends a 404 Error to the user
 func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
 
+// This sends a client error in the format negotiated for the response, the requests asking for JSON get it in the
+// envelope of the API
+func (app *application) negotiatedError(w http.ResponseWriter, format string, status int, code, message string) {
+	if format == mediaJSON {
+		apiError(w, status, code, message, nil)
+		return
+	}
+	app.clientError(w, status)
+}
+
+// This sends the error of a failed snippet lookup in the format negotiated for the response: a 404 for a missing
+// snippet, a 500 otherwise
+func (app *application) snippetError(w http.ResponseWriter, format string, err error) {
+	switch {
+	case format == mediaJSON && err == models.ErrNoRecord:
+		apiNotFound(w)
+	case format == mediaJSON:
+		app.apiServerError(w, err)
+	case err == models.ErrNoRecord:
+		app.notFound(w)
+	default:
+		app.serverError(w, err)
+	}
+}
+
 // To add default data to the templateData struct anytime a template is rendered
 func (app *application) addDefaultData(td *templateData, r *http.Request) *templateData {
 	if td == nil {
@@ -37,6 +122,7 @@ func (app *application) addDefaultData(td *templateData, r *http.Request) *templ
 	}
 
 	td.CSRFToken = nosurf.Token(r)
+	td.Languages = highlight.Languages
 	td.AuthenticatedUser = app.authenticatedUser(r)
 	td.CurrentYear = time.Now().Year()
 
@@ -87,3 +173,648 @@ func (app *application) authenticatedUser(r *http.Request) *models.User {
 
 	return user
 }
+
+// To retrieve the API token the request was authenticated with, nil when it has none
+func (app *application) apiToken(r *http.Request) *models.Token {
+	t, ok := r.Context().Value(contextKeyToken).(*models.Token)
+	if !ok {
+		return nil
+	}
+
+	return t
+}
+
+// To return the ID of the logged in user, or 0 for anonymous users
+func (app *application) viewerID(r *http.Request) int {
+	if user := app.authenticatedUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// To read the "page" query string value, falling back to the first page when it is missing or invalid
+func pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+
+	return page
+}
+
+// To check the fields shared by the create and edit snippet forms, expires must be one of the given values.
+// The files of an encrypted snippet must hold ciphertext
+func validateSnippetForm(form *forms.Form, encrypted bool, expires ...string) {
+	form.Required("title", "visibility", "expires")
+	form.MaxLength("title", 100)
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate)
+	form.PermittedValues("expires", expires...)
+	validateFiles(form, encrypted)
+}
+
+// The most views a burn after reading snippet can allow, and the number of days it is kept if it isn't read that many times
+const (
+	maxBurnViews   = 100
+	burnExpiryDays = 7
+)
+
+// To check the create snippet form, on top of the fields shared with the edit form. "burn" deletes the snippet after the
+// number of views given in the "views" field
+func validateCreateForm(form *forms.Form) {
+	validateSnippetForm(form, form.Get("encrypted") == "true", "365", "7", "1", "burn")
+	if form.Get("expires") == "burn" {
+		form.Required("views")
+		form.IntBetween("views", 1, maxBurnViews)
+	}
+	// bcrypt only uses the first 72 bytes of a password
+	form.MaxLength("password", 72)
+}
+
+// To build a new snippet from a valid create snippet form, owned by the user with userID (0 for an anonymous snippet).
+// It also returns the number of days before the snippet expires
+func newSnippet(form *forms.Form, userID int) (*models.Snippet, int, error) {
+	encrypted := form.Get("encrypted") == "true"
+	s := &models.Snippet{
+		UserID:     userID,
+		Title:      form.Get("title"),
+		Files:      filesFromForm(form, encrypted),
+		Visibility: form.Get("visibility"),
+		Encrypted:  encrypted,
+	}
+
+	// The optional password is stored as a bcrypt hash, like the user passwords
+	if password := form.Get("password"); password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return nil, 0, err
+		}
+		s.HashedPassword = hash
+	}
+
+	// A burn after reading snippet still expires, in case it is never read enough times
+	expires := burnExpiryDays
+	if form.Get("expires") == "burn" {
+		s.MaxViews, _ = strconv.Atoi(form.Get("views"))
+	} else {
+		expires, _ = strconv.Atoi(form.Get("expires"))
+	}
+
+	return s, expires, nil
+}
+
+// The largest request body accepted by the paste endpoint, 10 MB
+const maxPasteBytes = 10 << 20
+
+// To build the create snippet form of a paste request, see pasteSnippet. The fields missing from the request are given
+// the same defaults as the create form, except the visibility which is unlisted
+func pasteForm(r *http.Request) (*forms.Form, error) {
+	values := r.URL.Query()
+	names, contents := []string{}, []string{}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(maxPasteBytes)
+		if err != nil {
+			return nil, err
+		}
+		for field, vs := range r.MultipartForm.Value {
+			for _, v := range vs {
+				values.Add(field, v)
+			}
+		}
+		contents = append(contents, values["content"]...)
+		names = make([]string, len(contents))
+
+		// curl names the upload of its standard input "-"
+		for _, header := range r.MultipartForm.File["file"] {
+			content, err := readUpload(header)
+			if err != nil {
+				return nil, err
+			}
+			name := path.Base(header.Filename)
+			if name == "-" || name == "." || name == "/" {
+				name = ""
+			}
+			names = append(names, name)
+			contents = append(contents, content)
+		}
+	} else {
+		// Any other body is the content itself, whatever its type, as `curl --data-binary` sends it as a form
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		names, contents = []string{values.Get("file_name")}, []string{string(body)}
+	}
+
+	form := forms.New(values)
+	files := make([]fileField, len(contents))
+	for i := range files {
+		files[i] = fileField{Index: i, Name: names[i], Content: contents[i], Language: highlight.AutoDetect}
+		if langs := values["language"]; i < len(langs) {
+			files[i].Language = langs[i]
+		}
+	}
+	setFormFiles(form, files)
+
+	// The stored content must be text, unlike e.g. a binary uploaded by mistake
+	for i, content := range contents {
+		if !utf8.ValidString(content) {
+			form.Errors.Add(fmt.Sprintf("content.%d", i), "This must be UTF-8 text")
+		}
+	}
+
+	// The title defaults to the first file name
+	if form.Get("title") == "" {
+		form.Set("title", "Untitled paste")
+		for _, name := range names {
+			if name != "" {
+				form.Set("title", name)
+				break
+			}
+		}
+	}
+	if form.Get("visibility") == "" {
+		form.Set("visibility", models.VisibilityUnlisted)
+	}
+	if form.Get("expires") == "" {
+		form.Set("expires", "365")
+	}
+	// Pastes are never encrypted, that is only done in the browser
+	form.Del("encrypted")
+
+	return form, nil
+}
+
+// To read the content of a file uploaded in a multipart form
+func readUpload(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	return string(content), err
+}
+
+// To send the errors of an invalid form as plain text, one "field: message" line per error, with a 400 status
+func writeFormErrors(w http.ResponseWriter, form *forms.Form) {
+	fields := make([]string, 0, len(form.Errors))
+	for field := range form.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	for _, field := range fields {
+		for _, message := range form.Errors[field] {
+			fmt.Fprintf(w, "%s: %s\n", field, message)
+		}
+	}
+}
+
+// To return the scheme and host the request was made to, e.g. "https://localhost:4000", to make absolute links
+func baseURL(r *http.Request) string {
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host
+}
+
+// The most files a snippet can be made of
+const maxSnippetFiles = 10
+
+// The form fields holding the files of a snippet, each of them is repeated once per file
+var fileFieldNames = []string{"file_name", "content", "language"}
+
+// The values of one file in the snippet form. Index is its position, used in the keys of its errors, e.g. "content.0"
+type fileField struct {
+	Index    int
+	Name     string
+	Content  string
+	Language string
+}
+
+// To return the files of the snippet form, there is always at least one so the form shows an empty file to fill in
+func formFiles(form *forms.Form) []fileField {
+	n := 1
+	for _, field := range fileFieldNames {
+		n = max(n, len(form.Values[field]))
+	}
+	value := func(field string, i int) string {
+		if values := form.Values[field]; i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+
+	files := make([]fileField, n)
+	for i := range files {
+		files[i] = fileField{
+			Index:    i,
+			Name:     strings.TrimSpace(value("file_name", i)),
+			Content:  value("content", i),
+			Language: value("language", i),
+		}
+	}
+	return files
+}
+
+// To replace the files of the snippet form
+func setFormFiles(form *forms.Form, files []fileField) {
+	for _, field := range fileFieldNames {
+		form.Del(field)
+	}
+	for _, f := range files {
+		form.Add("file_name", f.Name)
+		form.Add("content", f.Content)
+		form.Add("language", f.Language)
+	}
+}
+
+// To return the form values of the files of a snippet. The detected languages are detected again when the files are saved
+func fileFields(files []*models.File) []fileField {
+	fields := make([]fileField, len(files))
+	for i, f := range files {
+		fields[i] = fileField{Index: i, Name: f.Name, Content: f.Content, Language: f.Language}
+		if f.LanguageConfidence < 1 {
+			fields[i].Language = highlight.AutoDetect
+		}
+	}
+	return fields
+}
+
+// To add or remove a file when the "add_file" or a "remove_file" button of the snippet form was used instead of the
+// submit button, which is how the form works without JavaScript. It returns false when the form was really submitted
+func changeFormFiles(form *forms.Form) bool {
+	files := formFiles(form)
+	if form.Get("add_file") != "" {
+		if len(files) >= maxSnippetFiles {
+			form.Errors.Add("files", fmt.Sprintf("A snippet can't have more than %d files", maxSnippetFiles))
+		} else {
+			files = append(files, fileField{Language: highlight.AutoDetect})
+		}
+	} else if v := form.Get("remove_file"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err == nil && i >= 0 && i < len(files) && len(files) > 1 {
+			files = append(files[:i], files[i+1:]...)
+		}
+	} else {
+		return false
+	}
+
+	setFormFiles(form, files)
+	return true
+}
+
+// The file names become the names of the files in the zip download, so they can't hold a path
+var fileNameRx = regexp.MustCompile(`^[^/\\[:cntrl:]]+$`)
+
+// To check each file of the snippet form, the errors of the file at index N are added to the "file_name.N", "content.N"
+// and "language.N" fields
+func validateFiles(form *forms.Form, encrypted bool) {
+	files := formFiles(form)
+	if len(files) > maxSnippetFiles {
+		form.Errors.Add("files", fmt.Sprintf("A snippet can't have more than %d files", maxSnippetFiles))
+	}
+
+	names := map[string]bool{}
+	for _, f := range files {
+		// To check each file with the usual validation methods, on a form of its own
+		ff := forms.New(url.Values{"file_name": {f.Name}, "content": {f.Content}, "language": {f.Language}})
+		ff.Required("content")
+		ff.MaxLength("file_name", 100)
+		ff.MatchesPattern("file_name", fileNameRx)
+		ff.PermittedValues("language", append(highlight.LanguageIDs(), highlight.AutoDetect)...)
+		if encrypted {
+			validateCiphertext(ff)
+		}
+		if f.Name == "." || f.Name == ".." {
+			ff.Errors.Add("file_name", "This is invalid")
+		} else if f.Name != "" && names[f.Name] {
+			ff.Errors.Add("file_name", "Another file has the same name")
+		}
+		names[f.Name] = true
+
+		for field, messages := range ff.Errors {
+			for _, message := range messages {
+				form.Errors.Add(fmt.Sprintf("%s.%d", field, f.Index), message)
+			}
+		}
+	}
+}
+
+// To build the files of a snippet from its validated form. The language of the files asking for it is detected, from
+// the file name (or the snippet title) and the content, which is left out for encrypted snippets as it is ciphertext.
+// The files without a name are named after their position and language, e.g. "file2.go"
+func filesFromForm(form *forms.Form, encrypted bool) []*models.File {
+	files := []*models.File{}
+	for _, f := range formFiles(form) {
+		file := &models.File{Name: f.Name, Content: f.Content, Language: f.Language, LanguageConfidence: 1}
+		if f.Language == highlight.AutoDetect {
+			hint, content := f.Name, f.Content
+			if hint == "" {
+				hint = form.Get("title")
+			}
+			if encrypted {
+				content = ""
+			}
+			file.Language, file.LanguageConfidence = highlight.Detect(hint, content)
+		}
+		if file.Name == "" {
+			file.Name = fmt.Sprintf("file%d%s", f.Index+1, highlight.Extension(file.Language))
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// The content of an encrypted snippet is the base64 encoding of the ciphertext made by ui/static/js/main.js
+var ciphertextRx = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+
+// To check that the content of an encrypted snippet was really encrypted in the browser, which isn't the case
+// when JavaScript is disabled. The server can't check more than that, the ciphertext is opaque to it
+func validateCiphertext(form *forms.Form) {
+	value := form.Get("content")
+	if value != "" && !ciphertextRx.MatchString(value) {
+		form.Errors.Add("content", "The content wasn't encrypted, encryption needs JavaScript to be enabled")
+	}
+}
+
+// To fetch the snippet from the ":slug" in the URL, as long as the current user is allowed to see it.
+// It sends the error response itself and returns false when the snippet can't be used
+func (app *application) snippetFromURL(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, err := app.snippets.GetBySlug(r.Context(), r.URL.Query().Get(":slug"), app.viewerID(r))
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// To fetch the snippet from the ":slug" in the URL, making sure it belongs to the logged in user.
+// It sends the error response itself and returns false when the snippet can't be used
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, ok := app.snippetFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// Only the author of a snippet is allowed to change it
+	if !s.OwnedBy(app.authenticatedUser(r).ID) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// To return the session key remembering that a protected snippet was unlocked
+func unlockedKey(s *models.Snippet) string {
+	return "unlocked:" + s.Slug
+}
+
+// To check if the password of the snippet must be given to read it, as it is protected and the requester isn't its
+// owner. The pages, the raw, download and zip endpoints, and the API all use this check
+func (app *application) needsPassword(r *http.Request, s *models.Snippet) bool {
+	return s.Protected() && !s.OwnedBy(app.viewerID(r))
+}
+
+// To check if the snippet needs its password and hasn't been unlocked in this session yet
+func (app *application) locked(r *http.Request, s *models.Snippet) bool {
+	return app.needsPassword(r, s) && !app.session.GetBool(r, unlockedKey(s))
+}
+
+// To fetch the snippet from the ":slug" in the URL for the raw and download endpoints, with the same visibility and
+// expiry checks as the snippet page, and read it, which counts as a view. When the URL has a ":file" name, the snippet
+// must have a file with that name. The files of an encrypted snippet can only be decrypted in the browser, and a
+// password protected snippet must have been unlocked on its page first.
+// It sends the error response itself and returns false when the snippet can't be used
+func (app *application) viewedSnippet(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	s, ok := app.snippetFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// To check the file before the view is counted
+	if name := r.URL.Query().Get(":file"); s.Encrypted || (name != "" && s.File(name) == nil) {
+		app.notFound(w)
+		return nil, false
+	}
+	if app.locked(r, s) {
+		app.clientError(w, http.StatusForbidden)
+		return nil, false
+	}
+
+	s, err := app.snippets.View(r.Context(), s.Slug, app.viewerID(r))
+	if err == models.ErrNoRecord {
+		app.notFound(w)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// To send the content of a file as UTF-8 plain text. The disposition is "inline" to show it in the browser, or
+// "attachment" to download it with the given file name
+func writeFile(w http.ResponseWriter, disposition, filename, content string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// Browsers must never guess another type, e.g. render a file holding HTML
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	io.WriteString(w, content)
+}
+
+// To send all the files of a snippet as a zip archive
+func (app *application) writeZip(w http.ResponseWriter, s *models.Snippet) {
+	// To write the archive to a buffer first, like the templates, so an error can still be sent as a 500 response
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, f := range s.Files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: s.Created})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		_, err = io.WriteString(fw, f.Content)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName(s, ".zip") + ".zip"}))
+	buf.WriteTo(w)
+}
+
+// The characters which aren't kept in the names of downloaded files
+var unsafeNameRx = regexp.MustCompile(`[^a-z0-9]+`)
+
+// To make the name of a downloaded file from the title of a snippet, without the given extension which is added after
+// it, e.g. "My Go snippet!" gives "my-go-snippet". The slug is used when the title has nothing left to use
+func downloadName(s *models.Snippet, ext string) string {
+	name := strings.TrimSuffix(strings.ToLower(s.Title), ext)
+	name = strings.Trim(unsafeNameRx.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return s.Slug
+	}
+	return name
+}
+
+// To find the revision with the given ID (as found in a URL) in a list of revisions, returning nil if there is none
+func findRevision(revisions []*models.Revision, idStr string) *models.Revision {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil
+	}
+
+	for _, rev := range revisions {
+		if rev.ID == id {
+			return rev
+		}
+	}
+	return nil
+}
+
+// To build the snippet listing filter from the query string. The returned form holds the values to redisplay
+// and an error for each value that couldn't be parsed
+func snippetFilter(r *http.Request) (models.SnippetFilter, *forms.Form) {
+	form := forms.New(r.URL.Query())
+	filter := models.SnippetFilter{Limit: snippetsPerPage}
+
+	if v := form.Get("author"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			form.Errors.Add("author", "This must be a user ID")
+		}
+		filter.UserID = id
+	}
+
+	// The dates are days in UTC, and the "to" day is included in the range
+	if v := form.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			form.Errors.Add("from", "This must be a date")
+		}
+		filter.CreatedFrom = t
+	}
+	if v := form.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			form.Errors.Add("to", "This must be a date")
+		}
+		filter.CreatedTo = t.AddDate(0, 0, 1)
+	}
+
+	if v := form.Get("expires"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 {
+			form.Errors.Add("expires", "This must be a number of days")
+		}
+		filter.ExpiresWithin = time.Duration(days) * 24 * time.Hour
+	}
+
+	var err error
+	if v := form.Get("after"); v != "" {
+		filter.After, err = models.DecodeCursor(v)
+	} else if v := form.Get("before"); v != "" {
+		filter.Before, err = models.DecodeCursor(v)
+	}
+	if err != nil {
+		form.Errors.Add("generic", "The page link is invalid")
+	}
+
+	return filter, form
+}
+
+// The media types the snippet pages can be sent as, besides HTML, for the tools reusing their URLs
+const (
+	mediaHTML = "text/html"
+	mediaJSON = "application/json"
+	mediaText = "text/plain"
+)
+
+// To pick the media type of the response from the Accept header of the request, among the offered ones. The first
+// offer is the default, used when the header is missing or accepts anything, and wins the ties
+func negotiate(w http.ResponseWriter, r *http.Request, offers ...string) string {
+	// Caches must keep one response per Accept header
+	w.Header().Add("Vary", "Accept")
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		q := acceptQuality(r.Header.Get("Accept"), offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// To return the quality the Accept header gives to a media type, from its most specific matching range, 1 when the
+// header is missing
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch rng {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				q = 0
+			}
+		}
+	}
+	return q
+}
+
+// To send the files of a snippet as plain text. A single file is sent as it is, several files are each preceded by
+// a "==> name <==" line, like head does
+func writeFiles(w http.ResponseWriter, files []*models.File) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if len(files) == 1 {
+		io.WriteString(w, files[0].Content)
+		return
+	}
+	for i, f := range files {
+		if i > 0 {
+			io.WriteString(w, "\n")
+		}
+		fmt.Fprintf(w, "==> %s <==\n%s\n", f.Name, strings.TrimSuffix(f.Content, "\n"))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"snippet-box/pkg/models"
+	"testing"
+)
+
+func TestServerErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   int
+		logged bool
+	}{
+		{"failure", errors.New("database is down"), http.StatusInternalServerError, true},
+		{"timeout", models.ErrTimeout, http.StatusServiceUnavailable, true},
+		{"canceled", fmt.Errorf("reading the snippet: %w", context.Canceled), statusClientClosedRequest, false},
+	}
+
+	for _, tt := range tests {
+		for _, helper := range []string{"serverError", "apiServerError"} {
+			t.Run(tt.name+"/"+helper, func(t *testing.T) {
+				app := newTestApplication(t)
+				var errorLog bytes.Buffer
+				app.errorLog = log.New(&errorLog, "", 0)
+
+				rr := httptest.NewRecorder()
+				if helper == "serverError" {
+					app.serverError(rr, tt.err)
+				} else {
+					app.apiServerError(rr, tt.err)
+				}
+
+				if rr.Code != tt.want {
+					t.Errorf("got status %d, want %d", rr.Code, tt.want)
+				}
+				if logged := errorLog.Len() > 0; logged != tt.logged {
+					t.Errorf("got the error logged %t, want %t", logged, tt.logged)
+				}
+			})
+		}
+	}
+}
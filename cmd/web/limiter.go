@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// To count attempts per key (e.g. per snippet) and block new attempts once too many were made within a time window.
+// An attempt is recorded as soon as it is allowed, and forgotten if it succeeds, so concurrent attempts can't all get
+// through while the first ones are still being checked
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string][]time.Time
+}
+
+// To initialize a limiter allowing max failed attempts per key within window
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: map[string][]time.Time{},
+	}
+}
+
+// To check if a new attempt is allowed for the key, and record it when it is. The caller must call Succeed if the
+// attempt turns out to be successful, otherwise it counts as a failure
+func (l *attemptLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempts := l.recent(key)
+	if len(attempts) >= l.max {
+		return false
+	}
+	l.attempts[key] = append(attempts, time.Now())
+	return true
+}
+
+// To forget a successful attempt for the key, only the failed ones are limited
+func (l *attemptLimiter) Succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempts := l.recent(key)
+	if len(attempts) == 0 {
+		return
+	}
+	if len(attempts) == 1 {
+		delete(l.attempts, key)
+		return
+	}
+	l.attempts[key] = attempts[:len(attempts)-1]
+}
+
+// To return the attempts of the key that are still inside the window, forgetting the older ones.
+// It must be called with the mutex held
+func (l *attemptLimiter) recent(key string) []time.Time {
+	cutoff := time.Now().Add(-l.window)
+
+	attempts := l.attempts[key]
+	for len(attempts) > 0 && attempts[0].Before(cutoff) {
+		attempts = attempts[1:]
+	}
+
+	if len(attempts) == 0 {
+		delete(l.attempts, key)
+		return nil
+	}
+	l.attempts[key] = attempts
+	return attempts
+}
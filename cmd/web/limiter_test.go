@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiterParallelAttempts(t *testing.T) {
+	l := newAttemptLimiter(5, time.Minute)
+
+	// The attempts made at the same time count before any of them is checked
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow("slug") {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 5 {
+		t.Errorf("got %d allowed attempts, want 5", n)
+	}
+	if !l.Allow("other") {
+		t.Error("the attempts of another key were limited")
+	}
+}
+
+func TestAttemptLimiterSucceed(t *testing.T) {
+	l := newAttemptLimiter(2, time.Minute)
+
+	// A successful attempt doesn't count, the failed ones do
+	for i := 0; i < 5; i++ {
+		if !l.Allow("slug") {
+			t.Fatalf("attempt %d was refused after successful attempts", i+1)
+		}
+		l.Succeed("slug")
+	}
+	l.Allow("slug")
+	l.Allow("slug")
+	if l.Allow("slug") {
+		t.Error("a third failed attempt was allowed")
+	}
+}
+
+func TestAttemptLimiterWindow(t *testing.T) {
+	l := newAttemptLimiter(1, time.Millisecond)
+
+	l.Allow("slug")
+	time.Sleep(5 * time.Millisecond)
+	if !l.Allow("slug") {
+		t.Error("an attempt was refused after the window")
+	}
+}
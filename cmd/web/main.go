@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"database/sql"
 	"flag"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"snippet-box/pkg/models/mysql"
+	"os/signal"
+	"snippet-box/pkg/highlight"
+	"snippet-box/pkg/models"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -20,20 +24,36 @@ type contextKey string
 
 var contextKeyUser = contextKey("user")
 
+// The API token a request was authenticated with, to check its scopes
+var contextKeyToken = contextKey("token")
+
 // To define an application struct to hold the application-wide dependencies
 type application struct {
 	errorLog *log.Logger
 	infoLog  *log.Logger
 	session  *sessions.Session
 	// To make the SnippetModel object available to the handlers
-	snippets      *mysql.SnippetModel
+	snippets      models.SnippetStore
 	templateCache map[string]*template.Template // templateCache field
-	users         *mysql.UserModel
+	highlightCSS  string                        // The stylesheet of the syntax highlighting themes
+	users         models.UserStore
+	tokens        models.TokenStore // The personal API tokens
+	// To limit the failed password attempts on each protected snippet
+	unlockAttempts *attemptLimiter
 }
 
 func main() {
 	// To create DB Connection Pool
-	dsn := flag.String("dsn", "web:webpassword@/snippetbox?parseTime=true", "MySQL database")
+	dsn := flag.String("dsn", "", "Database DSN, defaults to the local snippetbox database of the -db-driver")
+	// To pick the storage backend, the memory one needs no database server but forgets everything when the app stops
+	driver := flag.String("db-driver", "mysql", "Storage backend: mysql, sqlite, postgres or memory")
+	// To create or upgrade the database schema on startup, instead of running cmd/migrate first
+	autoMigrate := flag.Bool("auto-migrate", false, "Apply the pending database migrations on startup")
+	// To bound each database call, so a slow database fails the request with 503 instead of holding it
+	dbTimeout := flag.Duration("db-timeout", 5*time.Second, "Maximum duration of each database call, 0 for no limit")
+	// To remove the expired snippets from the storage in the background, they are only hidden otherwise
+	reapInterval := flag.Duration("reap-interval", 10*time.Minute, "How often expired snippets are deleted, 0 to never delete them")
+	reapBatch := flag.Int("reap-batch", 100, "Maximum number of expired snippets deleted in one transaction")
 	// To define a command-line flag with the name 'addr',
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	flag.Parse()
@@ -46,12 +66,16 @@ func main() {
 	// To create a logger for writing error messages
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	db, err := openDB(*dsn)
+	if *reapBatch < 1 {
+		errorLog.Fatal("-reap-batch must be at least 1")
+	}
+
+	stores, err := openStores(*driver, *dsn, *autoMigrate, infoLog)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
-	// To close the connection pool before the main() function exists
-	defer db.Close()
+	// To close the storage backend, e.g. its connection pool, before the main() function exists
+	defer stores.close()
 
 	// To initialize a new template cache
 	templateCache, err := newTemplateCache("ui/html/")
@@ -59,6 +83,12 @@ func main() {
 		errorLog.Fatal(err)
 	}
 
+	// To generate the stylesheet of the syntax highlighting themes
+	highlightCSS, err := highlight.CSS()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	// To initialize a new session manager that expires after 12 hours
 	session := sessions.New([]byte(*secret))
 	session.Lifetime = 12 * time.Hour
@@ -71,10 +101,13 @@ func main() {
 		errorLog: errorLog,
 		infoLog:  infoLog,
 		session:  session,
-		// To initialize a mysql.SnippetModel instance & add the application dependencies
-		snippets:      &mysql.SnippetModel{DB: db},
-		templateCache: templateCache, // templateCache
-		users:         &mysql.UserModel{DB: db},
+		// The stores of the storage backend, with the -db-timeout limit, & the other application dependencies
+		snippets:       models.SnippetStoreWithTimeout(stores.snippets, *dbTimeout),
+		templateCache:  templateCache, // templateCache
+		highlightCSS:   highlightCSS,
+		users:          models.UserStoreWithTimeout(stores.users, *dbTimeout),
+		tokens:         models.TokenStoreWithTimeout(stores.tokens, *dbTimeout),
+		unlockAttempts: newAttemptLimiter(5, 15*time.Minute),
 	}
 
 	// To initialize a tls.Config struct to hold the non-default TLS settings
@@ -105,20 +138,39 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// To stop the server and the background workers on an interrupt or termination signal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// To start the expiry reaper, main waits for it to finish its batch before returning
+	var workers sync.WaitGroup
+	if *reapInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			app.reapExpired(ctx, *reapInterval, *reapBatch)
+		}()
+	}
+
+	// To let the requests in progress finish once a signal is received, for up to the WriteTimeout of the server
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		infoLog.Print("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.WriteTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	infoLog.Printf("Starting server on %s", *addr)
 	// To call the ListenAndServe method on the new http.Server struct
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem") // To start the HTTPS server with self-signed TLS certificate
-	errorLog.Fatal(err)
-}
-
-// The openDB() function wraps sql.Open() and returns a sql.DB connection pool for a given DSN
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+	if err != http.ErrServerClosed {
+		errorLog.Fatal(err)
 	}
-	if err = db.Ping(); err != nil {
-		return nil, err
+	if err = <-shutdownErr; err != nil {
+		errorLog.Print(err)
 	}
-	return db, nil
+	workers.Wait()
+	infoLog.Print("Server stopped")
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"snippet-box/pkg/models"
+	"strings"
 
 	"github.com/justinas/nosurf"
 )
@@ -72,6 +73,66 @@ func noSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
+// To authenticate the requests made with a personal API token in an "Authorization: Bearer <token>" header, adding the
+// owner of the token to the request context like authenticate does. Requests without the header stay anonymous, but a
+// wrong token is refused rather than quietly ignored
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			app.unauthorized(w, r)
+			return
+		}
+		// The errors of the JSON API are sent in its envelope, like unauthorized does
+		serverError := app.serverError
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			serverError = app.apiServerError
+		}
+
+		t, err := app.tokens.Authenticate(r.Context(), token)
+		if err == models.ErrInvalidCredentials {
+			app.unauthorized(w, r)
+			return
+		} else if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		user, err := app.users.Get(r.Context(), t.UserID)
+		if err == models.ErrNoRecord {
+			app.unauthorized(w, r)
+			return
+		} else if err != nil {
+			serverError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeyToken, t)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// To refuse the requests made with an API token that wasn't given the scope needed by the route. Anonymous requests
+// go through, the handlers decide what they may do
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t := app.apiToken(r); t != nil && !t.HasScope(scope) {
+				app.insufficientScope(w, r, scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // This func fetches the details for the current user from the DB based on the userID in the session, and it adds the details to the request context
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -83,7 +144,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// To fetch the details of the current user from the DB, if no matching record is found remove the (invalid) userID from the session and call the next handler in chain
-		user, err := app.users.Get(app.session.GetInt(r, "userID"))
+		user, err := app.users.Get(r.Context(), app.session.GetInt(r, "userID"))
 		if err == models.ErrNoRecord {
 			app.session.Remove(r, "userID")
 			next.ServeHTTP(w, r)
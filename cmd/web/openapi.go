@@ -0,0 +1,278 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"snippet-box/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// An operation of the JSON API. The routes are registered, and described in /api/v1/openapi.json, from the same
+// table, so the specification can't drift away from the handlers and the types they encode
+type apiRoute struct {
+	Method    string
+	Pattern   string // The pat pattern, e.g. "/api/v1/snippets/:slug"
+	Handler   func(http.ResponseWriter, *http.Request)
+	Scope     string // The scope the API token needs
+	Anonymous bool   // Set when the request can also be made without a token
+	Summary   string
+	Params    []apiParam  // The query string and header parameters, the path parameters come from the pattern
+	Request   interface{} // A value of the type of the JSON body, nil when there is none
+	Status    int         // The status of a successful response
+	Response  interface{} // A value of the type of the JSON response, nil when the response has no body
+	Errors    []int       // The error statuses of the operation, besides the ones every operation can send
+}
+
+// A query string or header parameter of an API operation
+type apiParam struct {
+	Name        string
+	In          string // "query" or "header"
+	Description string
+	Format      string // The format of the string value, e.g. "date"
+}
+
+// The error statuses every API operation can send: a wrong token, a token without the scope, server errors, and
+// database calls which didn't finish in time
+var apiCommonErrors = []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError, http.StatusServiceUnavailable}
+
+// To return the operations of the JSON API, in the order they are documented
+func (app *application) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			Method: http.MethodGet, Pattern: "/api/v1/snippets", Handler: app.apiListSnippets,
+			Scope: models.ScopeRead, Anonymous: true,
+			Summary: "List the snippets, newest first, with the same filters as the home page",
+			Params: []apiParam{
+				{Name: "author", In: "query", Description: "Only the snippets of this user ID"},
+				{Name: "from", In: "query", Description: "Only the snippets created on or after this day", Format: "date"},
+				{Name: "to", In: "query", Description: "Only the snippets created on or before this day", Format: "date"},
+				{Name: "expires", In: "query", Description: "Only the snippets expiring within this many days"},
+				{Name: "after", In: "query", Description: "The next cursor of the previous page"},
+				{Name: "before", In: "query", Description: "The prev cursor of the next page"},
+			},
+			Status: http.StatusOK, Response: apiSnippetList{},
+			Errors: []int{http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodPost, Pattern: "/api/v1/snippets", Handler: app.apiCreateSnippet,
+			Scope:   models.ScopeWrite,
+			Summary: "Create a snippet owned by the user of the token",
+			Request: apiSnippetRequest{}, Status: http.StatusCreated, Response: apiSnippetBody{},
+			Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Pattern: "/api/v1/snippets/:slug", Handler: app.apiShowSnippet,
+			Scope: models.ScopeRead, Anonymous: true,
+			Summary: "Read a snippet with its files, this counts as a view",
+			Params: []apiParam{
+				{Name: "X-Snippet-Password", In: "header", Description: "The password of a password protected snippet"},
+			},
+			Status: http.StatusOK, Response: apiSnippetBody{},
+			Errors: []int{http.StatusNotFound, http.StatusTooManyRequests},
+		},
+		{
+			Method: http.MethodPatch, Pattern: "/api/v1/snippets/:slug", Handler: app.apiUpdateSnippet,
+			Scope:   models.ScopeWrite,
+			Summary: "Change a snippet of the user of the token, the fields left out keep their value",
+			Request: apiSnippetRequest{}, Status: http.StatusOK, Response: apiSnippetBody{},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodDelete, Pattern: "/api/v1/snippets/:slug", Handler: app.apiDeleteSnippet,
+			Scope:   models.ScopeDelete,
+			Summary: "Delete a snippet of the user of the token",
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodGet, Pattern: "/api/v1/user", Handler: app.apiShowUser,
+			Scope:   models.ScopeRead,
+			Summary: "Read the user of the token",
+			Status:  http.StatusOK, Response: apiUserBody{},
+		},
+	}
+}
+
+// GET /api/v1/openapi.json, to describe the JSON API in an OpenAPI 3.1 document, used to generate clients
+func (app *application) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeJSON(w, http.StatusOK, openAPISpec(app.apiRoutes()))
+}
+
+// To find the ":name" parameters of a pat pattern
+var patParamRx = regexp.MustCompile(`:(\w+)`)
+
+// To build the OpenAPI document of the API operations
+func openAPISpec(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	errorRef := schemaRef(reflect.TypeOf(apiErrorBody{}), schemas)
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		op := map[string]interface{}{
+			"operationId": operationID(route.Handler),
+			"summary":     route.Summary,
+		}
+
+		// The scopes are given as roles of the bearer scheme, an empty requirement means the token is optional
+		security := []interface{}{map[string][]string{"bearerAuth": {route.Scope}}}
+		if route.Anonymous {
+			security = append(security, map[string][]string{})
+		}
+		op["security"] = security
+
+		var params []interface{}
+		for _, m := range patParamRx.FindAllStringSubmatch(route.Pattern, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range route.Params {
+			schema := map[string]string{"type": "string"}
+			if p.Format != "" {
+				schema["format"] = p.Format
+			}
+			params = append(params, map[string]interface{}{
+				"name": p.Name, "in": p.In, "description": p.Description, "schema": schema,
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if route.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaRef(reflect.TypeOf(route.Request), schemas)),
+			}
+		}
+
+		responses := map[string]interface{}{}
+		success := map[string]interface{}{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			success["content"] = jsonContent(schemaRef(reflect.TypeOf(route.Response), schemas))
+		}
+		responses[strconv.Itoa(route.Status)] = success
+		for _, status := range append(route.Errors, apiCommonErrors...) {
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(errorRef),
+			}
+		}
+		op["responses"] = responses
+
+		path := patParamRx.ReplaceAllString(route.Pattern, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]string{
+			"title":   "Snippetbox API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal API token, created on the API tokens page. Its scopes are read, write and delete",
+				},
+			},
+		},
+	}
+}
+
+// To name an operation after its handler, e.g. apiListSnippets is "listSnippets"
+func operationID(handler func(http.ResponseWriter, *http.Request)) string {
+	// The name of a method value is e.g. "main.(*application).apiListSnippets-fm"
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	id := []rune(strings.TrimPrefix(name, "api"))
+	id[0] = unicode.ToLower(id[0])
+	return string(id)
+}
+
+// To return the JSON content of a request or response body with the given schema
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// To return the schema of a type, adding the named structs to the component schemas and referring to them by name
+func schemaRef(t reflect.Type, schemas map[string]interface{}) interface{} {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]string{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return schemaRef(t.Elem(), schemas)
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case t.Kind() == reflect.String:
+		return map[string]string{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]string{"type": "boolean"}
+	case t.Kind() == reflect.Int:
+		return map[string]string{"type": "integer"}
+	case t.Kind() == reflect.Float64:
+		return map[string]string{"type": "number"}
+	case t.Kind() != reflect.Struct:
+		panic("openapi: no schema for " + t.String())
+	}
+
+	// An anonymous struct is described where it is used
+	if t.Name() == "" {
+		return structSchema(t, schemas)
+	}
+	// The Go names lose their "api" prefix, e.g. apiSnippet is the Snippet schema
+	name := []rune(strings.TrimPrefix(t.Name(), "api"))
+	name[0] = unicode.ToUpper(name[0])
+	if _, ok := schemas[string(name)]; !ok {
+		// The entry is reserved first, in case the struct refers to itself
+		schemas[string(name)] = nil
+		schemas[string(name)] = structSchema(t, schemas)
+	}
+	return map[string]string{"$ref": "#/components/schemas/" + string(name)}
+}
+
+// To describe the JSON object of a struct. The fields are required unless they are pointers or have the omitempty
+// option, and an "enum" tag lists the allowed values of a string
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaRef(field.Type, schemas)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema = map[string]interface{}{"type": "string", "enum": strings.Split(enum, ",")}
+		}
+		properties[name] = schema
+
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
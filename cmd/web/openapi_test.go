@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"snippet-box/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// To return the "METHOD pattern" of every route registered in the pat router under the given path prefix.
+// pat keeps its routes in unexported fields, which reflection can still read
+func registeredRoutes(app *application, prefix string) []string {
+	var routes []string
+	handlers := reflect.ValueOf(app.router()).Elem().FieldByName("handlers")
+	for _, method := range handlers.MapKeys() {
+		list := handlers.MapIndex(method)
+		for i := 0; i < list.Len(); i++ {
+			pattern := list.Index(i).Elem().FieldByName("pat").String()
+			if strings.HasPrefix(pattern, prefix) {
+				routes = append(routes, method.String()+" "+pattern)
+			}
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// To return the "METHOD pattern" of every operation of the OpenAPI document, with the pat syntax for path parameters
+func documentedRoutes(spec map[string]interface{}) []string {
+	var routes []string
+	for path, ops := range spec["paths"].(map[string]map[string]interface{}) {
+		pattern := strings.NewReplacer("{", ":", "}", "").Replace(path)
+		for method := range ops {
+			routes = append(routes, strings.ToUpper(method)+" "+pattern)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// To return the statuses documented for an operation of the OpenAPI document
+func documentedStatuses(t *testing.T, spec map[string]interface{}, route string) []int {
+	t.Helper()
+
+	method, pattern, _ := strings.Cut(route, " ")
+	path := patParamRx.ReplaceAllString(pattern, "{$1}")
+	op, ok := spec["paths"].(map[string]map[string]interface{})[path][strings.ToLower(method)]
+	if !ok {
+		t.Fatalf("%s isn't documented", route)
+	}
+
+	var statuses []int
+	for status := range op.(map[string]interface{})["responses"].(map[string]interface{}) {
+		n, err := strconv.Atoi(status)
+		if err != nil {
+			t.Fatalf("%s documents the status %q", route, status)
+		}
+		statuses = append(statuses, n)
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+func TestOpenAPIPathsMatchRoutes(t *testing.T) {
+	app := newTestApplication(t)
+
+	// The document itself and the HEAD routes pat adds for the GET ones aren't API operations
+	var registered []string
+	for _, route := range registeredRoutes(app, "/api/") {
+		if !strings.HasPrefix(route, "HEAD ") && route != "GET /api/v1/openapi.json" {
+			registered = append(registered, route)
+		}
+	}
+	documented := documentedRoutes(openAPISpec(app.apiRoutes()))
+
+	if !reflect.DeepEqual(registered, documented) {
+		t.Errorf("the registered API routes\n%q\ndon't match the documented ones\n%q", registered, documented)
+	}
+}
+
+// A TokenStore failing every call, to get the server errors every operation can send
+type failingTokens struct {
+	err error
+}
+
+func (f *failingTokens) Insert(context.Context, int, string, []string) (string, error) {
+	return "", f.err
+}
+func (f *failingTokens) ByUser(context.Context, int) ([]*models.Token, error) { return nil, f.err }
+func (f *failingTokens) Revoke(context.Context, int, int) error               { return f.err }
+func (f *failingTokens) Authenticate(context.Context, string) (*models.Token, error) {
+	return nil, f.err
+}
+
+func TestOpenAPIStatusesMatchHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	spec := openAPISpec(app.apiRoutes())
+
+	owner := newTestUser(t, app, "owner@example.com")
+	other := newTestUser(t, app, "other@example.com")
+	full := newTestToken(t, app, owner, models.Scopes...)
+	readOnly := newTestToken(t, app, owner, models.ScopeRead)
+	writeOnly := newTestToken(t, app, owner, models.ScopeWrite)
+	otherFull := newTestToken(t, app, other, models.Scopes...)
+
+	slug := newTestSnippet(t, app, &models.Snippet{UserID: owner})
+	doomed := newTestSnippet(t, app, &models.Snippet{UserID: owner})
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := newTestSnippet(t, app, &models.Snippet{UserID: owner, HashedPassword: hash})
+
+	tooLarge := `{"title": "` + strings.Repeat("a", maxAPIBodyBytes) + `"}`
+	wrongPassword := http.Header{"X-Snippet-Password": {"wrong"}}
+
+	// The requests are sent in order, as some of them change the state the next ones see
+	tests := []struct {
+		route  string
+		path   string
+		token  string
+		body   string
+		header http.Header
+		want   int
+	}{
+		{"GET /api/v1/snippets", "/api/v1/snippets", "", "", nil, http.StatusOK},
+		{"GET /api/v1/snippets", "/api/v1/snippets?from=yesterday", "", "", nil, http.StatusUnprocessableEntity},
+		{"GET /api/v1/snippets", "/api/v1/snippets", "wrong", "", nil, http.StatusUnauthorized},
+		{"GET /api/v1/snippets", "/api/v1/snippets", writeOnly, "", nil, http.StatusForbidden},
+
+		{"POST /api/v1/snippets", "/api/v1/snippets", full, `{"title": "New", "files": [{"name": "a.txt", "content": "a"}]}`, nil, http.StatusCreated},
+		{"POST /api/v1/snippets", "/api/v1/snippets", full, `{"title": `, nil, http.StatusBadRequest},
+		{"POST /api/v1/snippets", "/api/v1/snippets", full, tooLarge, nil, http.StatusRequestEntityTooLarge},
+		{"POST /api/v1/snippets", "/api/v1/snippets", full, `{"title": ""}`, nil, http.StatusUnprocessableEntity},
+		{"POST /api/v1/snippets", "/api/v1/snippets", "", `{"title": "New"}`, nil, http.StatusUnauthorized},
+		{"POST /api/v1/snippets", "/api/v1/snippets", readOnly, `{"title": "New"}`, nil, http.StatusForbidden},
+
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, "", "", nil, http.StatusOK},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/missing", "", "", nil, http.StatusNotFound},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, "wrong", "", nil, http.StatusUnauthorized},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, writeOnly, "", nil, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusForbidden},
+		{"GET /api/v1/snippets/:slug", "/api/v1/snippets/" + protected, "", "", wrongPassword, http.StatusTooManyRequests},
+
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, full, `{"title": "Changed"}`, nil, http.StatusOK},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, full, `{"title": `, nil, http.StatusBadRequest},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/missing", full, `{"title": "Changed"}`, nil, http.StatusNotFound},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, full, tooLarge, nil, http.StatusRequestEntityTooLarge},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, full, `{"title": ""}`, nil, http.StatusUnprocessableEntity},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, "", `{"title": "Changed"}`, nil, http.StatusUnauthorized},
+		{"PATCH /api/v1/snippets/:slug", "/api/v1/snippets/" + slug, otherFull, `{"title": "Changed"}`, nil, http.StatusForbidden},
+
+		{"DELETE /api/v1/snippets/:slug", "/api/v1/snippets/missing", full, "", nil, http.StatusNotFound},
+		{"DELETE /api/v1/snippets/:slug", "/api/v1/snippets/" + doomed, "", "", nil, http.StatusUnauthorized},
+		{"DELETE /api/v1/snippets/:slug", "/api/v1/snippets/" + doomed, readOnly, "", nil, http.StatusForbidden},
+		{"DELETE /api/v1/snippets/:slug", "/api/v1/snippets/" + doomed, full, "", nil, http.StatusNoContent},
+
+		{"GET /api/v1/user", "/api/v1/user", full, "", nil, http.StatusOK},
+		{"GET /api/v1/user", "/api/v1/user", "", "", nil, http.StatusUnauthorized},
+		{"GET /api/v1/user", "/api/v1/user", writeOnly, "", nil, http.StatusForbidden},
+	}
+
+	seen := map[string]map[int]bool{}
+	check := func(h http.Handler, route, path, token, body string, header http.Header, want int) {
+		t.Helper()
+
+		method, _, _ := strings.Cut(route, " ")
+		res := send(t, h, method, path, token, body, header)
+		name := fmt.Sprintf("%s %s", method, path)
+		if len(name) > 80 {
+			name = name[:80]
+		}
+		if res.StatusCode != want {
+			t.Errorf("%s: got status %d, want %d", name, res.StatusCode, want)
+		}
+		// The responses with a body are JSON, the errors of the pat router itself would be plain text
+		if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); res.StatusCode != http.StatusNoContent && mediaType != "application/json" {
+			t.Errorf("%s: got a %q response, want JSON", name, mediaType)
+		}
+
+		if !slices.Contains(documentedStatuses(t, spec, route), res.StatusCode) {
+			t.Errorf("%s: the status %d isn't documented", name, res.StatusCode)
+		}
+		if seen[route] == nil {
+			seen[route] = map[int]bool{}
+		}
+		seen[route][res.StatusCode] = true
+	}
+
+	routes := app.routes()
+	for _, tt := range tests {
+		check(routes, tt.route, tt.path, tt.token, tt.body, tt.header, tt.want)
+	}
+
+	// Every operation can fail on the server, when the database fails or is too slow
+	for _, failure := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("database is down"), http.StatusInternalServerError},
+		{models.ErrTimeout, http.StatusServiceUnavailable},
+	} {
+		broken := newTestApplication(t)
+		broken.tokens = &failingTokens{failure.err}
+		for _, route := range broken.apiRoutes() {
+			path := strings.Replace(route.Pattern, ":slug", slug, 1)
+			check(broken.routes(), route.Method+" "+route.Pattern, path, full, "{}", nil, failure.want)
+		}
+	}
+
+	// Each documented status must be sent by one of the requests, so the list can't keep statuses the handlers dropped
+	for _, route := range app.apiRoutes() {
+		key := route.Method + " " + route.Pattern
+		for _, status := range documentedStatuses(t, spec, key) {
+			if !seen[key][status] {
+				t.Errorf("%s: no request got the documented status %d", key, status)
+			}
+		}
+	}
+}
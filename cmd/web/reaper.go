@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// To delete the expired snippets now and then every interval, until ctx is cancelled. Expired snippets are already
+// hidden by the stores, this is what actually removes their content from the database
+func (app *application) reapExpired(ctx context.Context, interval time.Duration, batch int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.reapExpiredOnce(ctx, batch)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// To delete every expired snippet, in batches of at most batch snippets so each transaction stays short
+func (app *application) reapExpiredOnce(ctx context.Context, batch int) {
+	total := 0
+	for ctx.Err() == nil {
+		n, err := app.snippets.DeleteExpired(ctx, batch)
+		total += n
+		if err != nil {
+			// An error caused by the shutdown isn't worth reporting, the next run finishes the work
+			if ctx.Err() == nil {
+				app.errorLog.Printf("Deleting expired snippets: %s", err)
+			}
+			break
+		}
+		if n < batch {
+			break
+		}
+	}
+
+	if total > 0 {
+		app.infoLog.Printf("Deleted %d expired snippets", total)
+	}
+}
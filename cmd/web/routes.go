@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"snippet-box/pkg/models"
 
 	"github.com/bmizerany/pat"
 	"github.com/justinas/alice"
@@ -11,15 +12,44 @@ import (
 func (app *application) routes() http.Handler {
 	// To create a middleware chain containing all standard middleware, which will be used for every request the application uses
 	standardMiddleware := alice.New(app.recoverPanic, app.recoverPanic, secureHeaders)
+	return standardMiddleware.Then(app.router())
+}
+
+// To register the routes of the application, each with the middleware specific to it
+func (app *application) router() *pat.PatternServeMux {
 	// To create a middleware chain containing the middleware specific to our dynamic application routes
 	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.authenticate) // To use the noSurf, and authenticate Middleware on all dynamic routes
+	// The routes used from the command line have no session or CSRF token, the user is authenticated by an API token instead
+	tokenMiddleware := alice.New(app.authenticateToken)
 
 	mux := pat.New()
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
+	mux.Get("/search", dynamicMiddleware.ThenFunc(app.searchSnippets))
 
 	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippetForm)) // To display the form
 	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippet))    // To submit the form
-	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet))
+	mux.Get("/snippet/:slug", dynamicMiddleware.ThenFunc(app.showSnippet))
+	mux.Post("/snippet/:slug/unlock", dynamicMiddleware.ThenFunc(app.unlockSnippet))
+	mux.Get("/snippet/:slug/edit", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.editSnippetForm))
+	mux.Post("/snippet/:slug/edit", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.editSnippet))
+	mux.Post("/snippet/:slug/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.deleteSnippet))
+	mux.Get("/snippet/:slug/history", dynamicMiddleware.ThenFunc(app.snippetHistory))
+	mux.Post("/snippet/:slug/history/:rev/restore", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.restoreRevision))
+	mux.Get("/snippet/:slug/zip", dynamicMiddleware.ThenFunc(app.downloadZip))
+	mux.Get("/snippet/:slug/download", dynamicMiddleware.ThenFunc(app.downloadSnippet))
+	mux.Get("/snippet/:slug/raw", dynamicMiddleware.ThenFunc(app.rawSnippet))
+	mux.Get("/snippet/:slug/raw/:file", dynamicMiddleware.ThenFunc(app.rawFile))
+	mux.Post("/paste", tokenMiddleware.Append(app.requireScope(models.ScopeWrite)).ThenFunc(app.pasteSnippet))
+
+	// The JSON API, each operation needs a scope from the API token
+	for _, route := range app.apiRoutes() {
+		handler := tokenMiddleware.Append(app.requireScope(route.Scope)).ThenFunc(route.Handler)
+		if route.Method == http.MethodGet {
+			mux.Head(route.Pattern, handler)
+		}
+		mux.Add(route.Method, route.Pattern, handler)
+	}
+	mux.Get("/api/v1/openapi.json", http.HandlerFunc(app.openAPI))
 
 	// For Authentication
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.displayUserRegistrationForm))
@@ -28,8 +58,19 @@ func (app *application) routes() http.Handler {
 	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
 	mux.Post("/user/logout", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.logoutUser))
 
+	// For snippet listings by author
+	mux.Get("/user/snippets", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.mySnippets))
+	mux.Get("/user/:id/snippets", dynamicMiddleware.ThenFunc(app.userSnippets))
+
+	// For the personal API tokens
+	mux.Get("/user/tokens", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.listTokens))
+	mux.Post("/user/tokens", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createToken))
+	mux.Post("/user/tokens/:id/revoke", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.revokeToken))
+
+	// The highlighting stylesheet is generated, so it is registered before the static file server
+	mux.Get("/static/css/highlight.css", http.HandlerFunc(app.highlightStylesheet))
 	fileServer := http.FileServer(http.Dir("./ui/static"))
 	mux.Get("/static/", http.StripPrefix("/static", fileServer))
 
-	return standardMiddleware.Then(mux)
+	return mux
 }
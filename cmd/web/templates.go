@@ -1,31 +1,241 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"snippet-box/pkg/diff"
 	"snippet-box/pkg/forms"
+	"snippet-box/pkg/highlight"
 	"snippet-box/pkg/models"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // To set the holding structure for any dynamic data to be passed to HTML templates
 type templateData struct {
-	CSRFToken         string          // For CSRF
-	AuthenticatedUser *models.User    // To pass the user details value from the request context
-	CurrentYear       int             // Field for Current Year
-	Flash             string          // Flash field for the flash confirmation message
-	Form              *forms.Form     // Pointer to single form field
-	Snippet           *models.Snippet // A pointer to a single Snippet from models package
+	CSRFToken         string               // For CSRF
+	AuthenticatedUser *models.User         // To pass the user details value from the request context
+	CurrentYear       int                  // Field for Current Year
+	Flash             string               // Flash field for the flash confirmation message
+	Form              *forms.Form          // Pointer to single form field
+	Owner             *models.User         // The user whose snippets are being listed
+	Pagination        *pagination          // Previous/next page numbers for paginated listings
+	Query             string               // The search query, used to highlight the matches
+	Languages         []highlight.Language // The languages offered by the language picker
+	Revisions         []*models.Revision   // All the saved revisions of a snippet
+	Diff              *revisionDiff        // The diff between two revisions on the history page
+	Snippet           *models.Snippet      // A pointer to a single Snippet from models package
+	PasteURL          string               // The absolute URL of the paste endpoint, for the command line examples
+	Token             string               // A newly created API token, shown only once
+	Tokens            []*models.Token      // The API tokens of the logged in user
+	Scopes            []string             // The scopes an API token can be given
 	// To include a Snippets field in the templateData struct
 	Snippets []*models.Snippet // A slice of Snippet pointers, holding multiple snippets
 
 }
 
+// The number of snippets shown on each page of a listing
+const snippetsPerPage = 10
+
+// To hold the links to the previous and next pages of a listing, an empty link means there is no such page
+type pagination struct {
+	PrevURL string
+	NextURL string
+}
+
+// To build the pagination of a listing paged with page numbers, hasNext reports whether more rows exist after the current page
+func newPagination(r *http.Request, page int, hasNext bool) *pagination {
+	p := &pagination{}
+	if page > 1 {
+		p.PrevURL = pageURL(r, "page", strconv.Itoa(page-1))
+	}
+	if hasNext {
+		p.NextURL = pageURL(r, "page", strconv.Itoa(page+1))
+	}
+	return p
+}
+
+// To build the pagination of a listing paged with cursors, using the "after" and "before" query string values
+func newCursorPagination(r *http.Request, page *models.SnippetPage) *pagination {
+	p := &pagination{}
+	if page.Prev != nil {
+		p.PrevURL = pageURL(r, "before", page.Prev.Encode())
+	}
+	if page.Next != nil {
+		p.NextURL = pageURL(r, "after", page.Next.Encode())
+	}
+	return p
+}
+
+// To build a link to another page of the current listing, keeping the other values of the query string (e.g. a search query)
+func pageURL(r *http.Request, key, value string) string {
+	params := url.Values{key: {value}}
+	for k, v := range r.URL.Query() {
+		// The ":name" values are added to the query string by the router, so they are not copied
+		if strings.HasPrefix(k, ":") || k == "page" || k == "after" || k == "before" {
+			continue
+		}
+		params[k] = v
+	}
+	return "?" + params.Encode()
+}
+
+// To hold the two revisions being compared on the history page and the diff between their files
+type revisionDiff struct {
+	From  *models.Revision
+	To    *models.Revision
+	Files []fileDiff // Only the files which changed
+}
+
+// The diff of one file between two revisions, OldName is empty for an added file and NewName for a removed one.
+// TooLarge is set instead of the hunks when the file has too many lines to be diffed
+type fileDiff struct {
+	OldName  string
+	NewName  string
+	Hunks    []diff.Hunk
+	TooLarge bool
+}
+
+// To diff the files of two revisions, matching them by name. The changed files are listed in the order of the newer
+// revision, followed by the removed files
+func diffFiles(from, to []*models.File) []fileDiff {
+	old := map[string]*models.File{}
+	for _, f := range from {
+		old[f.Name] = f
+	}
+
+	diffs := []fileDiff{}
+	for _, f := range to {
+		d := fileDiff{NewName: f.Name}
+		oldContent := ""
+		if o, ok := old[f.Name]; ok {
+			d.OldName, oldContent = o.Name, o.Content
+			delete(old, f.Name)
+		}
+		hunks, err := diff.Unified(oldContent, f.Content, 3)
+		d.Hunks, d.TooLarge = hunks, err == diff.ErrTooLarge
+		if len(d.Hunks) > 0 || d.TooLarge || d.OldName == "" {
+			diffs = append(diffs, d)
+		}
+	}
+	for _, f := range from {
+		if _, ok := old[f.Name]; ok {
+			hunks, err := diff.Unified(f.Content, "", 3)
+			diffs = append(diffs, fileDiff{OldName: f.Name, Hunks: hunks, TooLarge: err == diff.ErrTooLarge})
+		}
+	}
+	return diffs
+}
+
 // Human Date Function
 func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// To return an HTML-escaped copy of text with every occurrence of the words in query wrapped in a <mark> tag
+func markMatches(query, text string) template.HTML {
+	var terms []string
+	for _, term := range searchTerms(query) {
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	if len(terms) == 0 {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	rx := regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[loc[0]:loc[1]]) + "</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// To return a short part of text around the first word of query it contains, or its beginning if there is none
+func excerpt(query, text string) string {
+	const width = 200
+
+	start := 0
+	lower := strings.ToLower(text)
+	for _, term := range searchTerms(query) {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 {
+			start = max(i-width/4, 0)
+			break
+		}
+	}
+
+	// To make sure the excerpt doesn't cut a multi-byte character in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := min(start+width, len(text))
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	out := text[start:end]
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(text) {
+		out += "…"
+	}
+	return out
+}
+
+// To split a search query into the words used for highlighting, ignoring the MySQL boolean search operators
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`+-<>()~*"@`, r)
+	})
+}
+
+// To syntax highlight the content of a snippet, falling back to plain text if the highlighter fails
+func syntax(content, language string) template.HTML {
+	h, err := highlight.HTML(content, language)
+	if err != nil {
+		return template.HTML("<pre><code>" + template.HTMLEscapeString(content) + "</code></pre>")
+	}
+	return h
+}
+
+// To format a confidence between 0 and 1 as a rounded percentage, e.g. "87%"
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
+}
+
+// To escape a value for a URL path segment matched by a pat ":name" parameter. pat decodes the parameters with
+// url.QueryUnescape, so a "+" must be escaped as well for the value to be read back unchanged
+func pathParam(s string) string {
+	return url.QueryEscape(s)
+}
+
+// The custom functions made available to the templates
+var functions = template.FuncMap{
+	"humanDate":    humanDate,
+	"markMatches":  markMatches,
+	"excerpt":      excerpt,
+	"syntax":       syntax,
+	"languageName": highlight.LanguageName,
+	"percent":      percent,
+	"formFiles":    formFiles,
+	"pathParam":    pathParam,
+	"contains":     slices.Contains[[]string],
+}
+
 // To create an in memory map to cache the templates
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	// To initialize a new map to act as the cache || empty map to store parsed templates
@@ -40,8 +250,8 @@ func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	for _, page := range pages {
 		// extract each file name, from the full file path & assign it to the name variable
 		name := filepath.Base(page)
-		// Parse the page template in to a template set
-		ts, err := template.ParseFiles(page)
+		// Parse the page template in to a template set, registering the custom template functions first
+		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
 		if err != nil {
 			return nil, err
 		}
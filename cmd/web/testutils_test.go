@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"snippet-box/pkg/models"
+	"snippet-box/pkg/models/memory"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golangcollege/sessions"
+)
+
+// To create an application backed by the memory stores, with its templates and silent loggers
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	templateCache, err := newTemplateCache("../../ui/html/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessions.New([]byte("3dSm5MnygFHh7XidAtbskXrjbwfoJcbJ"))
+	session.Lifetime = 12 * time.Hour
+	session.Secure = true
+
+	db := memory.New()
+	return &application{
+		errorLog:       log.New(io.Discard, "", 0),
+		infoLog:        log.New(io.Discard, "", 0),
+		session:        session,
+		snippets:       &memory.SnippetModel{DB: db},
+		templateCache:  templateCache,
+		users:          &memory.UserModel{DB: db},
+		tokens:         &memory.TokenModel{DB: db},
+		unlockAttempts: newAttemptLimiter(5, 15*time.Minute),
+	}
+}
+
+// To add a user to the stores of the application, returning their ID
+func newTestUser(t *testing.T, app *application, email string) int {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := app.users.Insert(ctx, "Test", email, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.users.Authenticate(ctx, email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// To create an API token with the given scopes for a user
+func newTestToken(t *testing.T, app *application, userID int, scopes ...string) string {
+	t.Helper()
+
+	token, err := app.tokens.Insert(context.Background(), userID, "test", scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// To add a snippet with a single file to the stores of the application, returning its slug
+func newTestSnippet(t *testing.T, app *application, s *models.Snippet) string {
+	t.Helper()
+
+	if s.Title == "" {
+		s.Title = "Test"
+	}
+	if s.Visibility == "" {
+		s.Visibility = models.VisibilityPublic
+	}
+	if s.Files == nil {
+		s.Files = []*models.File{{Name: "main.go", Content: "package main"}}
+	}
+	slug, err := app.snippets.Insert(context.Background(), s, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slug
+}
+
+// To send a request through the routes of the application, with an API token when token isn't empty
+func send(t *testing.T, h http.Handler, method, path, token, body string, header http.Header) *http.Response {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr.Result()
+}
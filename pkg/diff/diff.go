@@ -0,0 +1,295 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The kind of change a diff line represents
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// A single line of a diff, with its line numbers in the old and new text (0 when it doesn't exist there)
+type Line struct {
+	Op    Op
+	Text  string
+	OldNo int
+	NewNo int
+}
+
+// To return the unified diff prefix of the line (" ", "+" or "-")
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	}
+	return " "
+}
+
+// A group of nearby changes surrounded by some unchanged context lines
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// To return the "@@ -1,3 +1,4 @@" header of the hunk
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// To split a text into lines, ignoring a trailing newline and normalising CRLF line endings
+func SplitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// The most lines, old and new together, Unified diffs between the first and the last changed lines. The time taken
+// grows with the number of these lines times the number of changes, so more could keep the server busy for too long
+const MaxLines = 5000
+
+// ErrTooLarge is returned by Unified when the changed part of the texts has more than MaxLines lines
+var ErrTooLarge = errors.New("diff: too many lines to diff")
+
+// To compute the unified line diff between two texts, keeping the given number of context lines around each change.
+// It returns no hunks when the texts are equal, and ErrTooLarge when too many lines changed, see MaxLines
+func Unified(a, b string, context int) ([]Hunk, error) {
+	if a == b {
+		return nil, nil
+	}
+	oldLines, newLines := SplitLines(a), SplitLines(b)
+	if changedLines(oldLines, newLines) > MaxLines {
+		return nil, ErrTooLarge
+	}
+	lines := Lines(oldLines, newLines)
+
+	var hunks []Hunk
+	// The number of old and new lines walked past so far
+	oldSeen, newSeen := 0, 0
+	for i := 0; i < len(lines); {
+		// To skip ahead to the next change
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// To find the end of this hunk, merging changes which are separated by less than 2*context equal lines
+		start := max(i-context, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = next
+		}
+
+		for _, l := range lines[:start] {
+			if l.OldNo > 0 {
+				oldSeen = l.OldNo
+			}
+			if l.NewNo > 0 {
+				newSeen = l.NewNo
+			}
+		}
+		hunks = append(hunks, newHunk(lines[start:end], oldSeen, newSeen))
+		i = end
+	}
+
+	return hunks, nil
+}
+
+// To count the lines of a and b left once their common first and last lines are put aside
+func changedLines(a, b []string) int {
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	return len(a) + len(b) - 2*(start+end)
+}
+
+// To build a hunk from a run of diff lines, given how many old and new lines come before it
+func newHunk(lines []Line, oldBefore, newBefore int) Hunk {
+	h := Hunk{Lines: lines, OldStart: oldBefore, NewStart: newBefore}
+	for _, l := range lines {
+		if l.OldNo > 0 {
+			h.OldLines++
+		}
+		if l.NewNo > 0 {
+			h.NewLines++
+		}
+	}
+
+	// As in the unified diff format, an empty side of a hunk points at the line before it
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+// To compute the full line-by-line edit script turning a into b, using the linear space version of Myers' O(ND)
+// algorithm: the middle snake of the shortest edit script splits the texts in two halves which are diffed in turn,
+// so only two vectors of len(a)+len(b) diagonals are kept, whatever the number of changes
+func Lines(a, b []string) []Line {
+	// The lines are compared as integers, equal lines having the same one
+	ids := map[string]int{}
+	d := &differ{a: intern(a, ids), b: intern(b, ids), deleted: make([]bool, len(a)), inserted: make([]bool, len(b))}
+	size := 2*(len(a)+len(b)) + 4
+	d.forward, d.backward = make([]int, size), make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+
+	// To merge the two texts back, the deletions coming before the insertions of each change
+	lines := make([]Line, 0, max(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			lines = append(lines, Line{Op: Delete, Text: a[i], OldNo: i + 1})
+			i++
+		case j < len(b) && d.inserted[j]:
+			lines = append(lines, Line{Op: Insert, Text: b[j], NewNo: j + 1})
+			j++
+		default:
+			lines = append(lines, Line{Op: Equal, Text: a[i], OldNo: i + 1, NewNo: j + 1})
+			i++
+			j++
+		}
+	}
+	return lines
+}
+
+// To replace each line by an integer, the same for equal lines
+func intern(lines []string, ids map[string]int) []int {
+	out := make([]int, len(lines))
+	for i, l := range lines {
+		id, ok := ids[l]
+		if !ok {
+			id = len(ids)
+			ids[l] = id
+		}
+		out[i] = id
+	}
+	return out
+}
+
+// To hold the state of a diff: the two texts, the lines found to be deleted from a and inserted in b, and the
+// furthest reaching x of the forward and backward paths on each diagonal, reused by every middle snake
+type differ struct {
+	a, b              []int
+	deleted, inserted []bool
+	forward, backward []int
+}
+
+// To find the changes between a[aLo:aHi] and b[bLo:bHi]
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// The common prefix and suffix are unchanged
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			d.inserted[y] = true
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			d.deleted[x] = true
+		}
+	default:
+		x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// To find the middle snake of the shortest edit script between a[aLo:aHi] and b[bLo:bHi], both not empty and starting
+// and ending with different lines, by following the paths from both ends until they overlap. It returns a point of
+// the snake which both halves of the script have at least one edit on their side of, so each half is smaller
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	// The x of diagonal k (x - y) is at index offset+k, the backward paths count x and y from the ends of the texts
+	offset := len(d.forward) / 2
+	vf, vb := d.forward, d.backward
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+
+			// The backward paths of the previous step are on the diagonals delta-k
+			if kb := delta - k; odd && kb >= -(D-1) && kb <= D-1 && x+vb[offset+kb] >= n {
+				return aLo + startX, bLo + startY
+			}
+		}
+
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+
+			if kf := delta - k; !odd && kf >= -D && kf <= D && x+vf[offset+kf] >= n {
+				return aHi - startX, bHi - startY
+			}
+		}
+	}
+
+	// The paths always meet within (n+m+1)/2 steps
+	panic("diff: no middle snake")
+}
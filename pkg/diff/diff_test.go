@@ -0,0 +1,147 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// To write hunks in the unified diff format, without the file headers
+func render(hunks []Hunk) string {
+	var sb strings.Builder
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, l := range h.Lines {
+			sb.WriteString(l.Prefix() + l.Text + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"both empty", "", "", ""},
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"from empty", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a\nb\n", "", "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"insert only", "a\nb\nc\n", "a\nb\nx\nc\n", "@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n"},
+		{"delete only", "a\nb\nx\nc\n", "a\nb\nc\n", "@@ -1,4 +1,3 @@\n a\n b\n-x\n c\n"},
+		{"fully replaced", "a\nb\n", "x\ny\nz\n", "@@ -1,2 +1,3 @@\n-a\n-b\n+x\n+y\n+z\n"},
+		{"trailing newline removed", "a\nb\n", "a\nb", ""},
+		{"trailing newline added", "a\nb", "a\nb\n", ""},
+		{"line added after a missing trailing newline", "a\nb", "a\nb\nc\n", "@@ -1,2 +1,3 @@\n a\n b\n+c\n"},
+		{"CRLF line endings", "a\r\nb\r\n", "a\nb\n", ""},
+		{
+			"distant changes in two hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n", "1\nx\n3\n4\n5\n6\n7\n8\n9\ny\n11\n",
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -7,5 +7,5 @@\n 7\n 8\n 9\n-10\n+y\n 11\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, err := Unified(tt.a, tt.b, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := render(hunks); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedTooLarge(t *testing.T) {
+	a := strings.Repeat("a\n", MaxLines/2)
+	b := strings.Repeat("b\n", MaxLines/2+1)
+	if _, err := Unified(a, b, 3); err != ErrTooLarge {
+		t.Errorf("got error %v, want ErrTooLarge", err)
+	}
+	// Equal texts need no diff, whatever their size
+	if hunks, err := Unified(b, b, 3); err != nil || hunks != nil {
+		t.Errorf("got %d hunks and error %v for equal texts, want none", len(hunks), err)
+	}
+	// Only the lines between the first and the last change count
+	if hunks, err := Unified(b, b+"c\n", 3); err != nil || len(hunks) != 1 {
+		t.Errorf("got %d hunks and error %v for a line added to a long text, want 1 hunk", len(hunks), err)
+	}
+}
+
+// To return the length of the longest common subsequence of a and b, the number of lines a shortest edit script keeps
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// To check that lines is an edit script turning a into b which keeps as many lines as possible
+func checkScript(t *testing.T, a, b []string, lines []Line) {
+	t.Helper()
+
+	var old, new []string
+	equal := 0
+	for _, l := range lines {
+		if l.Op != Insert {
+			old = append(old, l.Text)
+			if l.OldNo != len(old) {
+				t.Fatalf("got old line number %d, want %d", l.OldNo, len(old))
+			}
+		}
+		if l.Op != Delete {
+			new = append(new, l.Text)
+			if l.NewNo != len(new) {
+				t.Fatalf("got new line number %d, want %d", l.NewNo, len(new))
+			}
+		}
+		if l.Op == Equal {
+			equal++
+		}
+	}
+	if strings.Join(old, "\n") != strings.Join(a, "\n") || strings.Join(new, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("the script doesn't turn %q into %q", a, b)
+	}
+	if want := lcs(a, b); equal != want {
+		t.Fatalf("the script turning %q into %q keeps %d lines, want %d", a, b, equal, want)
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		checkScript(t, a, b, Lines(a, b))
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	// Every line changed, the worst case for the number of steps
+	a, b := make([]string, 3000), make([]string, 3000)
+	for i := range a {
+		a[i], b[i] = fmt.Sprintf("old %d", i), fmt.Sprintf("new %d", i)
+	}
+	lines := Lines(a, b)
+	if len(lines) != len(a)+len(b) {
+		t.Errorf("got %d lines, want %d", len(lines), len(a)+len(b))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
@@ -84,6 +85,18 @@ func (f *Form) MatchesPattern(field string, pattern *regexp.Regexp) {
 	}
 }
 
+// To check if a specific form field is a whole number between min and max (inclusive)
+func (f *Form) IntBetween(field string, min, max int) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		f.Errors.Add(field, fmt.Sprintf("This field must be a number between %d and %d", min, max))
+	}
+}
+
 // To implement a method that returns true when there is no error
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
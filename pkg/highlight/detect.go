@@ -0,0 +1,229 @@
+package highlight
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The language picker value asking for the language to be guessed with Detect
+const AutoDetect = "auto"
+
+// The confidence given to the guesses made from a shebang line or a file name in the title
+const (
+	shebangConfidence   = 0.95
+	extensionConfidence = 0.9
+)
+
+// The languages of the interpreters found in shebang lines, e.g. "#!/usr/bin/env python3"
+var interpreters = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "bash",
+	"dash":    "bash",
+	"ksh":     "bash",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"node":    "javascript",
+	"nodejs":  "javascript",
+	"deno":    "typescript",
+	"ruby":    "ruby",
+	"php":     "php",
+	"make":    "makefile",
+}
+
+// The languages of the file extensions and file names that can appear in a snippet title
+var extensions = map[string]string{
+	".go":         "go",
+	".sql":        "sql",
+	".yml":        "yaml",
+	".yaml":       "yaml",
+	".json":       "json",
+	".sh":         "bash",
+	".bash":       "bash",
+	".py":         "python",
+	".js":         "javascript",
+	".mjs":        "javascript",
+	".ts":         "typescript",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".java":       "java",
+	".c":          "c",
+	".h":          "c",
+	".cpp":        "cpp",
+	".cc":         "cpp",
+	".hpp":        "cpp",
+	".css":        "css",
+	".html":       "html",
+	".htm":        "html",
+	".md":         "markdown",
+	".toml":       "toml",
+	".ini":        "ini",
+	".cfg":        "ini",
+	".php":        "php",
+	".diff":       "diff",
+	".patch":      "diff",
+	".dockerfile": "docker",
+	".mk":         "makefile",
+	"dockerfile":  "docker",
+	"makefile":    "makefile",
+	"go.mod":      "go",
+	"gnumakefile": "makefile",
+}
+
+// A token heuristic: a pattern which, when it matches a line of the content, counts weight points for a language
+type rule struct {
+	language string
+	weight   int
+	pattern  *regexp.Regexp
+}
+
+func newRule(language string, weight int, pattern string) rule {
+	return rule{language, weight, regexp.MustCompile(pattern)}
+}
+
+var rules = []rule{
+	newRule("go", 5, `^package \w+$`),
+	newRule("go", 3, `^import \($|^import "`),
+	newRule("go", 3, `^func (\(\w+ \*?\w+\) )?\w+\(`),
+	newRule("go", 2, `:= |\berr != nil\b|\bfmt\.\w+\(`),
+	newRule("sql", 4, `(?i)^\s*(SELECT\b.+\bFROM|INSERT INTO|UPDATE \w+ SET|DELETE FROM|CREATE (TABLE|INDEX|DATABASE)|ALTER TABLE|DROP TABLE)\b`),
+	newRule("sql", 1, `(?i)\b(WHERE|JOIN|GROUP BY|ORDER BY|VARCHAR|PRIMARY KEY)\b`),
+	newRule("yaml", 2, `^[\w.-]+:( [^{}();]*)?$`),
+	newRule("yaml", 2, `^\s+- [\w"']`),
+	newRule("yaml", 3, `^---$`),
+	newRule("json", 2, `^\s*"[^"]+"\s*:\s*`),
+	newRule("json", 1, `^\s*[\[{]\s*$`),
+	newRule("bash", 2, `^\s*(export \w+=|echo |if \[|fi$|then$|done$|sudo |apt(-get)? |cd |set -e)`),
+	newRule("bash", 1, `\$\{?\w+\}?|\|\s*(grep|awk|sed|xargs)\b`),
+	newRule("python", 4, `^\s*def \w+\(.*\):$`),
+	newRule("python", 3, `^(from [\w.]+ import|import \w+$)|^\s*class \w+(\(.*\))?:$|if __name__ == .__main__.:`),
+	newRule("python", 1, `^\s*(elif|except|print\()|\bself\.`),
+	newRule("javascript", 3, `\b(const|let) \w+ = |\bfunction\s*\w*\(|=> \{|console\.log\(|require\(['"]`),
+	newRule("javascript", 2, `\bdocument\.|\bwindow\.|module\.exports`),
+	newRule("typescript", 4, `^\s*(interface|type) \w+ (=|\{)|:\s*(string|number|boolean)\b[;,)=]`),
+	newRule("rust", 4, `^\s*(pub )?fn \w+.*->|^\s*let mut |^use \w+::|println!\(|impl \w+`),
+	newRule("java", 4, `^\s*(public|private|protected) (static )?(class|void|[A-Z]\w*) \w+|System\.out\.print`),
+	newRule("c", 3, `^#include <\w+\.h>`),
+	newRule("c", 2, `^\s*(static )?(int|void|char|long|unsigned)\s+\*?\w+\(.*\)|\b(printf|malloc|free)\(`),
+	newRule("cpp", 4, `^#include <\w+>$|std::|\bcout <<`),
+	newRule("ruby", 3, `^\s*(def \w+[?!]?$|end$|require ['"]|puts )|\.each do \|`),
+	newRule("php", 5, `^<\?php`),
+	newRule("php", 2, `\$\w+->\w+|\becho \$`),
+	newRule("html", 4, `(?i)^<!doctype html|<html\b|</(div|body|head|p|span)>`),
+	newRule("css", 3, `^[.#]?[\w-]+(\s*[.#:>]?[\w-]+)*\s*\{$|^\s*[\w-]+:\s*[^;]+;$`),
+	newRule("diff", 4, `^@@ -\d+(,\d+)? \+\d+(,\d+)? @@`),
+	newRule("diff", 2, `^(---|\+\+\+) (a/|b/|/dev/null)`),
+	newRule("docker", 4, `^(FROM \S+|RUN |COPY |ENTRYPOINT |CMD \[|WORKDIR )`),
+	newRule("makefile", 3, `^[\w.-]+:( [\w. -]+)?$|^\t(@|\$\(\w+\))`),
+	newRule("markdown", 2, "^#{1,6} \\w|^```|^\\* \\w|^\\[.+\\]\\(.+\\)"),
+	newRule("toml", 2, `^\[\[?[\w.-]+\]\]?$`),
+	newRule("toml", 2, `^[\w-]+ = ("|\d|true$|false$|\[)`),
+	newRule("ini", 2, `^\[[\w .-]+\]$`),
+	newRule("ini", 2, `^[\w.-]+\s*=\s*[^\s"\d\[]`),
+}
+
+// To guess the language of a snippet from a shebang line, a file name in its title, or else from its content.
+// It returns the language ID and a confidence between 0 and 1, or an empty ID (plain text) when there is no good guess
+func Detect(title, content string) (string, float64) {
+	if lang := fromShebang(content); lang != "" {
+		return lang, shebangConfidence
+	}
+	if lang := fromTitle(title); lang != "" {
+		return lang, extensionConfidence
+	}
+	return fromTokens(content)
+}
+
+// To read the interpreter of a "#!" first line
+func fromShebang(content string) string {
+	first, _, _ := strings.Cut(content, "\n")
+	if !strings.HasPrefix(first, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(first, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := path.Base(fields[0])
+	// "#!/usr/bin/env -S python3 -u" names the interpreter in a later field
+	if interpreter == "env" {
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = f
+				break
+			}
+		}
+	}
+
+	// To also know versioned names like "python3.12" or "ruby3.2"
+	if lang, ok := interpreters[interpreter]; ok {
+		return lang
+	}
+	return interpreters[strings.TrimRight(interpreter, "0123456789.")]
+}
+
+// To find a known file name or extension in one of the words of the title
+func fromTitle(title string) string {
+	for _, word := range strings.Fields(strings.ToLower(title)) {
+		word = strings.Trim(word, `"'()[]<>,:;`)
+		if lang, ok := extensions[word]; ok {
+			return lang
+		}
+		if lang, ok := extensions[path.Ext(word)]; ok && len(word) > len(path.Ext(word)) {
+			return lang
+		}
+	}
+	return ""
+}
+
+// The minimum score the best language must reach, and the minimum confidence of its guess, before the guess is used.
+// Below them the content is too short or too ambiguous, and plain text is better than the wrong highlighting
+const (
+	minScore      = 4
+	minConfidence = 0.25
+)
+
+// To score each language with the token rules, and return the best one. The confidence is the share of the points
+// it won, lowered when there were few points, so a guess from the content alone is never certain
+func fromTokens(content string) (string, float64) {
+	scores := map[string]int{}
+	total := 0
+
+	lines := strings.Split(content, "\n")
+	for _, line := range lines[:min(len(lines), 200)] {
+		line = strings.TrimRight(line, "\r")
+		for _, r := range rules {
+			if r.pattern.MatchString(line) {
+				scores[r.language] += r.weight
+				total += r.weight
+			}
+		}
+	}
+
+	// To sort the languages by score, breaking ties by name so the result is stable
+	langs := make([]string, 0, len(scores))
+	for lang := range scores {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if scores[langs[i]] != scores[langs[j]] {
+			return scores[langs[i]] > scores[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+
+	if len(langs) == 0 || scores[langs[0]] < minScore {
+		return "", 0
+	}
+	best := langs[0]
+	score := float64(scores[best])
+	confidence := score / float64(total) * score / (score + minScore)
+	if confidence < minConfidence {
+		return "", 0
+	}
+	return best, confidence
+}
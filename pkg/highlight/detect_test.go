@@ -0,0 +1,56 @@
+package highlight
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		title      string
+		content    string
+		want       string
+		confidence float64 // The exact confidence, or 0 to only check it is between minConfidence and 1
+	}{
+		{"shebang", "", "#!/bin/bash\nls\n", "bash", shebangConfidence},
+		{"shebang with env", "", "#!/usr/bin/env python3\nprint(1)\n", "python", shebangConfidence},
+		{"shebang with env flags", "", "#!/usr/bin/env -S node --no-warnings\n", "javascript", shebangConfidence},
+		{"versioned interpreter", "", "#!/usr/local/bin/ruby3.2\nputs 1\n", "ruby", shebangConfidence},
+		{"shebang before the title", "main.go", "#!/bin/sh\necho hi\n", "bash", shebangConfidence},
+		{"unknown interpreter", "script.py", "#!/usr/bin/awk -f\n{ print }\n", "python", extensionConfidence},
+		{"title extension", "My handler.go", "x\n", "go", extensionConfidence},
+		{"title extension in punctuation", "Config (app.yaml):", "x\n", "yaml", extensionConfidence},
+		{"title extension case", "SCHEMA.SQL", "x\n", "sql", extensionConfidence},
+		{"title file name", "The Dockerfile of the app", "x\n", "docker", extensionConfidence},
+		{"title file name with a dot", "go.mod", "x\n", "go", extensionConfidence},
+		{"title without a file name", "Notes on v1.2", "", "", 0},
+		{"go tokens", "", "package main\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n", "go", 0},
+		{"sql tokens", "Query", "SELECT id, title FROM snippets WHERE id = 1;\n", "sql", 0},
+		{"python tokens", "", "def f(x):\n    return x\n", "python", 0},
+		{"json tokens", "", "{\n  \"a\": 1,\n  \"b\": 2\n}\n", "json", 0},
+		{"docker tokens", "", "FROM golang:1.22\nRUN go build\n", "docker", 0},
+		{"empty content", "", "", "", 0},
+		{"plain text", "", "hello world\nthis is some text\n", "", 0},
+		{"too short", "", "x := 1\n", "", 0},
+		{"ambiguous", "", "echo $HOME\nname: x\nkey: $y\n", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, confidence := Detect(tt.title, tt.content)
+			if lang != tt.want {
+				t.Fatalf("got %q, want %q", lang, tt.want)
+			}
+			switch {
+			case lang == "":
+				if confidence != 0 {
+					t.Errorf("got confidence %v for plain text, want 0", confidence)
+				}
+			case tt.confidence != 0:
+				if confidence != tt.confidence {
+					t.Errorf("got confidence %v, want %v", confidence, tt.confidence)
+				}
+			case confidence < minConfidence || confidence >= 1:
+				t.Errorf("got confidence %v, want a guess from the content between %v and 1", confidence, minConfidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package highlight
+
+import (
+	"bufio"
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// A language that can be picked for a snippet, ID is the name of its chroma lexer
+type Language struct {
+	ID   string
+	Name string
+	Ext  string // The usual file extension, used to name the files which don't have a name
+}
+
+// The languages offered by the language picker, the empty ID is plain text
+var Languages = []Language{
+	{"", "Plain text", ".txt"},
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"cpp", "C++", ".cpp"},
+	{"css", "CSS", ".css"},
+	{"diff", "Diff", ".diff"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"html", "HTML", ".html"},
+	{"ini", "INI", ".ini"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"makefile", "Makefile", ".mk"},
+	{"markdown", "Markdown", ".md"},
+	{"php", "PHP", ".php"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"sql", "SQL", ".sql"},
+	{"toml", "TOML", ".toml"},
+	{"typescript", "TypeScript", ".ts"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// To return the IDs of all the languages, e.g. to check a form value with forms.PermittedValues
+func LanguageIDs() []string {
+	ids := make([]string, len(Languages))
+	for i, l := range Languages {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+// To return the display name of a language ID
+func LanguageName(id string) string {
+	for _, l := range Languages {
+		if l.ID == id {
+			return l.Name
+		}
+	}
+	return id
+}
+
+// To return the usual file extension of a language ID, ".txt" for plain text and unknown languages
+func Extension(id string) string {
+	for _, l := range Languages {
+		if l.ID == id {
+			return l.Ext
+		}
+	}
+	return ".txt"
+}
+
+// The themes the highlighted code can be shown in, each one is selected by a CSS class
+var themes = []struct {
+	Class string
+	Style string
+}{
+	{"theme-light", "github"},
+	{"theme-dark", "monokai"},
+}
+
+// The formatter uses CSS classes rather than inline styles, so the theme can be switched without highlighting again
+var formatter = html.New(
+	html.WithClasses(true),
+	html.WithCSSComments(false),
+	html.WithLineNumbers(true),
+	html.LineNumbersInTable(true),
+	html.TabWidth(4),
+)
+
+// To highlight code written in the given language as HTML, with line numbers.
+// An empty or unknown language is shown as plain text
+func HTML(code, language string) (template.HTML, error) {
+	lexer := lexers.Fallback
+	if language != "" {
+		if l := lexers.Get(language); l != nil {
+			lexer = l
+		}
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, styles.Fallback, iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+// To return the stylesheet of all the themes. The rules of each theme only apply inside an element with its class
+func CSS() (string, error) {
+	var b strings.Builder
+	for _, theme := range themes {
+		var buf bytes.Buffer
+		err := formatter.WriteCSS(&buf, styles.Get(theme.Style))
+		if err != nil {
+			return "", err
+		}
+
+		// WriteCSS writes one rule per line, each one is scoped to the theme class
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			b.WriteString("." + theme.Class + " " + scanner.Text() + "\n")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,386 @@
+// Package migrations creates and upgrades the schema of the database storage backends from versioned SQL files
+// embedded in the binary. The files of a backend are in the directory named after its driver, e.g. mysql/, as pairs
+// of <version>_<name>.up.sql and <version>_<name>.down.sql files, and the applied versions are recorded in the
+// schema_migrations table of the database.
+//
+// A database created before the migrations existed has the baseline schema: a snippets table holding the content of
+// each snippet and a users table, without a schema_migrations table. Up adopts such a database by marking it as
+// version 0, then upgrading it to version 1 with the baseline.sql file of the driver instead of the first migration
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"snippet-box/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql postgres sqlite
+var files embed.FS
+
+// A version of the schema, with the SQL statements to upgrade a database to it and to revert it
+type Migration struct {
+	Version int
+	Name    string
+	up      []string
+	down    []string
+}
+
+// The state of a migration in a database
+type Status struct {
+	*Migration
+	Applied time.Time // When the migration was applied, zero while it is pending
+}
+
+// What differs between the databases when keeping track of the applied migrations and adopting a baseline database
+type dialect struct {
+	createTable string // To create the schema_migrations table if it doesn't exist
+	insert      string // To record an applied migration from its version, name and time
+	delete      string // To forget a reverted migration from its version
+	baseline    string // To count the content columns of the snippets table, 1 for a database with the baseline schema
+	setSlug     string // To set the slug of an adopted snippet from the slug and its ID
+	// To move the tables of a baseline database out of the way of the tables created by the first migration. The index
+	// names of SQLite and PostgreSQL are unique in the whole schema, so their baseline index is dropped as well
+	renameBaseline []string
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied DATETIME NOT NULL)`,
+		insert: `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+		delete: `DELETE FROM schema_migrations WHERE version = ?`,
+		baseline: `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'content'`,
+		setSlug: `UPDATE snippets SET slug = ? WHERE id = ?`,
+		renameBaseline: []string{
+			`ALTER TABLE snippets RENAME TO baseline_snippets`,
+			`ALTER TABLE users RENAME TO baseline_users`,
+		},
+	},
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, applied DATETIME NOT NULL)`,
+		insert:   `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+		delete:   `DELETE FROM schema_migrations WHERE version = ?`,
+		baseline: `SELECT COUNT(*) FROM pragma_table_info('snippets') WHERE name = 'content'`,
+		setSlug:  `UPDATE snippets SET slug = ? WHERE id = ?`,
+		renameBaseline: []string{
+			`DROP INDEX IF EXISTS idx_snippets_created`,
+			`ALTER TABLE snippets RENAME TO baseline_snippets`,
+			`ALTER TABLE users RENAME TO baseline_users`,
+		},
+	},
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied TIMESTAMPTZ NOT NULL)`,
+		insert: `INSERT INTO schema_migrations (version, name, applied) VALUES ($1, $2, $3)`,
+		delete: `DELETE FROM schema_migrations WHERE version = $1`,
+		baseline: `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'snippets' AND column_name = 'content'`,
+		setSlug: `UPDATE snippets SET slug = $1 WHERE id = $2`,
+		renameBaseline: []string{
+			`DROP INDEX IF EXISTS idx_snippets_created`,
+			`ALTER TABLE snippets RENAME TO baseline_snippets`,
+			`ALTER TABLE users RENAME TO baseline_users`,
+		},
+	},
+}
+
+// To define a Migrator type that applies the migrations of a driver to the database of a sql.DB connection pool
+type Migrator struct {
+	DB         *sql.DB
+	dialect    dialect
+	migrations []*Migration // Ordered by version
+	baseline   []string     // To copy the data of a baseline database into the tables of version 1
+}
+
+// To create a Migrator for a database of the given driver: "mysql", "sqlite" or "postgres"
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("migrations: no migrations for the %q driver", driver)
+	}
+	migrations, err := load(driver)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := fs.ReadFile(files, driver+"/baseline.sql")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, dialect: d, migrations: migrations, baseline: split(string(baseline))}, nil
+}
+
+// To read the migrations in the directory of a driver, checking every version has both an up and a down file
+func load(driver string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.Name() == "baseline.sql" {
+			continue
+		}
+		// The name of a file is e.g. "0001_create_tables.up.sql"
+		base, ok := strings.CutSuffix(entry.Name(), ".sql")
+		prefix, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: unexpected file %s/%s", driver, entry.Name())
+		}
+		name, direction, _ := strings.Cut(name, ".")
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d of %s is both %s and %s", version, driver, m.Name, name)
+		}
+
+		content, err := fs.ReadFile(files, driver+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		switch direction {
+		case "up":
+			m.up = split(string(content))
+		case "down":
+			m.down = split(string(content))
+		default:
+			return nil, fmt.Errorf("migrations: unexpected file %s/%s", driver, entry.Name())
+		}
+	}
+
+	migrations := []*Migration{}
+	for _, m := range byVersion {
+		if m.up == nil || m.down == nil {
+			return nil, fmt.Errorf("migrations: version %d of %s needs an up and a down file", m.Version, driver)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// To split the content of a file into statements, as the MySQL driver runs a single statement at a time.
+// A statement ends with a semicolon at the end of a line, unless it is between "-- +begin" and "-- +end" lines,
+// which keep together the statements with semicolons of their own, such as triggers
+func split(content string) []string {
+	statements := []string{}
+	var stmt strings.Builder
+	block := false
+	for _, line := range strings.Split(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case "-- +begin":
+			block = true
+			continue
+		case "-- +end":
+			block = false
+		default:
+			stmt.WriteString(line + "\n")
+			if block || !strings.HasSuffix(strings.TrimSpace(line), ";") {
+				continue
+			}
+		}
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			statements = append(statements, s)
+		}
+		stmt.Reset()
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+// To return every migration, oldest first, with the time it was applied to the database
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*Status{}
+	for _, migration := range m.migrations {
+		statuses = append(statuses, &Status{Migration: migration, Applied: applied[migration.Version]})
+	}
+	return statuses, nil
+}
+
+// To apply the pending migrations in order, returning the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []*Migration{}
+	if len(applied) == 0 && len(m.migrations) > 0 {
+		adopted, err := m.adopt(ctx, m.migrations[0])
+		if err != nil {
+			return done, fmt.Errorf("migrations: adopting the baseline schema: %w", err)
+		}
+		if adopted {
+			applied[m.migrations[0].Version] = time.Now().UTC()
+			done = append(done, m.migrations[0])
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err = m.run(ctx, migration.up, m.dialect.insert, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migrations: applying %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// To upgrade a database with the baseline schema to the first migration, in a transaction, reporting whether the
+// database had the baseline schema. The baseline tables are renamed, the first migration creates the new ones, the
+// baseline.sql file copies the users and snippets into them, with the content of each snippet as its single file,
+// and each snippet gets a random slug. Version 0 is recorded along with the first migration, so the database shows
+// it was adopted
+func (m *Migrator) adopt(ctx context.Context, first *Migration) (bool, error) {
+	var columns int
+	if err := m.DB.QueryRowContext(ctx, m.dialect.baseline).Scan(&columns); err != nil || columns == 0 {
+		return false, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	statements := append(append(append([]string{}, m.dialect.renameBaseline...), first.up...), m.baseline...)
+	for _, stmt := range statements {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return false, err
+		}
+	}
+
+	// The slugs are generated like the ones of new snippets, which SQL can't do
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM snippets`)
+	if err != nil {
+		return false, err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		slug, err := models.NewSlug()
+		if err != nil {
+			return false, err
+		}
+		if _, err = tx.ExecContext(ctx, m.dialect.setSlug, slug, id); err != nil {
+			return false, err
+		}
+	}
+
+	at := time.Now().UTC()
+	if _, err = tx.ExecContext(ctx, m.dialect.insert, 0, "baseline", at); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, m.dialect.insert, first.Version, first.Name, at); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// To revert the last applied migration, returning it, or nil when no migration is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	last := 0
+	for version := range applied {
+		last = max(last, version)
+	}
+	if last == 0 {
+		return nil, nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version != last {
+			continue
+		}
+		err = m.run(ctx, migration.down, m.dialect.delete, migration.Version)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: reverting %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return migration, nil
+	}
+	// The database was migrated by a newer version of the application
+	return nil, fmt.Errorf("migrations: the applied version %d is unknown", last)
+}
+
+// To run the statements of a migration and record it in a transaction, so a failed migration is left out entirely.
+// MySQL commits each schema change on its own though, so a failed MySQL migration may need to be cleaned up by hand
+func (m *Migrator) run(ctx context.Context, statements []string, record string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// To return when each applied migration was applied, by version, creating the schema_migrations table if needed
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	_, err := m.DB.ExecContext(ctx, m.dialect.createTable)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,163 @@
+package migrations_test
+
+import (
+	"context"
+	"path/filepath"
+	"snippet-box/pkg/migrations"
+	"snippet-box/pkg/models"
+	"snippet-box/pkg/models/sqlite"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The schema of the databases created before the migrations existed, the content is in the snippets table
+const baselineSchema = `
+CREATE TABLE snippets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL
+);
+CREATE INDEX idx_snippets_created ON snippets (created);
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT 1
+);`
+
+func TestUpAdoptsBaseline(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open("file:" + filepath.Join(t.TempDir(), "snippetbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("pa55word"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().UTC().Add(-time.Hour)
+	_, err = db.Exec(`INSERT INTO users (id, name, email, hashed_password, created) VALUES (3, 'Alice', 'alice@example.com', ?, ?)`,
+		string(hash), created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, content := range map[int]string{4: "first snippet", 7: "second snippet"} {
+		_, err = db.Exec(`INSERT INTO snippets (id, title, content, created, expires) VALUES (?, ?, ?, ?, ?)`,
+			id, "Snippet "+strconv.Itoa(id), content, created, created.Add(24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done[0].Version != 1 || done[1].Version != 2 {
+		t.Fatalf("got %d applied migrations, want versions 1 and 2", len(done))
+	}
+
+	var versions []int
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var v int
+		if err = rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if len(versions) != 3 || versions[0] != 0 || versions[1] != 1 || versions[2] != 2 {
+		t.Errorf("got the recorded versions %v, want [0 1 2]", versions)
+	}
+
+	snippets := &sqlite.SnippetModel{DB: db}
+	s, err := snippets.Get(ctx, 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 1 || s.Files[0].Content != "second snippet" || s.Title != "Snippet 7" {
+		t.Errorf("got the snippet %q with %d files, want the baseline content as its single file", s.Title, len(s.Files))
+	}
+	if _, err = strconv.Atoi(s.Slug); err == nil || len(s.Slug) != 10 {
+		t.Errorf("got the slug %q, want a random slug", s.Slug)
+	}
+	if found, err := snippets.Search(ctx, "first", 0, 10, 0); err != nil || len(found) != 1 || found[0].ID != 4 {
+		t.Errorf("got %d results and error %v searching the adopted content, want snippet 4", len(found), err)
+	}
+
+	// The new rows follow the copied IDs
+	users := &sqlite.UserModel{DB: db}
+	if id, err := users.Authenticate(ctx, "alice@example.com", "pa55word"); err != nil || id != 3 {
+		t.Errorf("got user %d and error %v, want user 3", id, err)
+	}
+	_, err = snippets.Insert(ctx, &models.Snippet{
+		Title: "New", Visibility: models.VisibilityPublic, Files: []*models.File{{Content: "new"}},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := snippets.Get(ctx, 8, 0); err != nil || s.Title != "New" {
+		t.Errorf("got error %v, want the new snippet to have the ID 8", err)
+	}
+
+	// An adopted database is migrated like any other from then on
+	if done, err = migrator.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("got %d migrations and error %v on the second Up, want none", len(done), err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = migrator.Down(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m, err := migrator.Down(ctx); err != nil || m != nil {
+		t.Errorf("got a reverted migration or error %v with only the baseline left, want none", err)
+	}
+	if done, err = migrator.Up(ctx); err != nil || len(done) != 2 {
+		t.Errorf("got %d migrations and error %v after reverting everything, want 2", len(done), err)
+	}
+}
+
+func TestUpEmptyDatabase(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open("file:" + filepath.Join(t.TempDir(), "snippetbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var adopted int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = 0`).Scan(&adopted); err != nil {
+		t.Fatal(err)
+	}
+	if adopted != 0 {
+		t.Error("an empty database was recorded as adopted from the baseline")
+	}
+}
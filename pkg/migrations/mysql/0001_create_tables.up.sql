@@ -0,0 +1,75 @@
+CREATE TABLE users (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT uc_users_email UNIQUE (email)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
+
+-- The slugs are compared with their case, the default collation would make "aB" and "Ab" the same slug
+CREATE TABLE snippets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug VARCHAR(10) COLLATE utf8mb4_bin NOT NULL,
+    user_id INTEGER,
+    title VARCHAR(100) NOT NULL,
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    max_views INTEGER NOT NULL DEFAULT 0,
+    views INTEGER NOT NULL DEFAULT 0,
+    password_hash VARBINARY(60),
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT uc_snippets_slug UNIQUE (slug),
+    CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users (id),
+    INDEX idx_snippets_created (created, id),
+    INDEX idx_snippets_user (user_id, created, id),
+    FULLTEXT INDEX ft_snippets_title (title)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
+
+CREATE TABLE snippet_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    language VARCHAR(100) NOT NULL DEFAULT '',
+    language_confidence DOUBLE NOT NULL DEFAULT 1,
+    CONSTRAINT uc_snippet_files_position UNIQUE (snippet_id, position),
+    CONSTRAINT fk_snippet_files_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id),
+    FULLTEXT INDEX ft_snippet_files (name, content)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
+
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER,
+    title VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_snippet_revisions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id),
+    CONSTRAINT fk_snippet_revisions_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
+
+CREATE TABLE snippet_revision_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    revision_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    language VARCHAR(100) NOT NULL DEFAULT '',
+    language_confidence DOUBLE NOT NULL DEFAULT 1,
+    CONSTRAINT uc_snippet_revision_files_position UNIQUE (revision_id, position),
+    CONSTRAINT fk_snippet_revision_files_revision FOREIGN KEY (revision_id) REFERENCES snippet_revisions (id)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
+
+-- Only the SHA-256 hash of each token is kept
+CREATE TABLE api_tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    token_hash BINARY(32) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT uc_api_tokens_hash UNIQUE (token_hash),
+    CONSTRAINT fk_api_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8mb4;
@@ -0,0 +1,6 @@
+DROP TABLE api_tokens;
+DROP TABLE snippet_revision_files;
+DROP TABLE snippet_revisions;
+DROP TABLE snippet_files;
+DROP TABLE snippets;
+DROP TABLE users;
@@ -0,0 +1,73 @@
+-- The email addresses are unique without case, like with the collation of the MySQL table
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60) NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX uc_users_email ON users (lower(email));
+
+-- The titles and the files are searched through generated tsvector columns with GIN indexes. A tsvector holds at most
+-- 1MB of words, so only the first 200000 characters of a file are indexed, which is at most 800KB of UTF-8
+CREATE TABLE snippets (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(10) NOT NULL CONSTRAINT uc_snippets_slug UNIQUE,
+    user_id INTEGER REFERENCES users (id),
+    title VARCHAR(100) NOT NULL,
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    max_views INTEGER NOT NULL DEFAULT 0,
+    views INTEGER NOT NULL DEFAULT 0,
+    password_hash BYTEA,
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    created TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ NOT NULL,
+    title_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', title)) STORED
+);
+CREATE INDEX idx_snippets_created ON snippets (created, id);
+CREATE INDEX idx_snippets_user ON snippets (user_id, created, id);
+CREATE INDEX idx_snippets_title_tsv ON snippets USING GIN (title_tsv);
+
+CREATE TABLE snippet_files (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id),
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    language VARCHAR(100) NOT NULL DEFAULT '',
+    language_confidence DOUBLE PRECISION NOT NULL DEFAULT 1,
+    tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || left(content, 200000))) STORED,
+    CONSTRAINT uc_snippet_files_position UNIQUE (snippet_id, position)
+);
+CREATE INDEX idx_snippet_files_tsv ON snippet_files USING GIN (tsv);
+
+CREATE TABLE snippet_revisions (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id),
+    user_id INTEGER REFERENCES users (id),
+    title VARCHAR(100) NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_snippet_revisions_snippet ON snippet_revisions (snippet_id);
+
+CREATE TABLE snippet_revision_files (
+    id SERIAL PRIMARY KEY,
+    revision_id INTEGER NOT NULL REFERENCES snippet_revisions (id),
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    language VARCHAR(100) NOT NULL DEFAULT '',
+    language_confidence DOUBLE PRECISION NOT NULL DEFAULT 1,
+    CONSTRAINT uc_snippet_revision_files_position UNIQUE (revision_id, position)
+);
+
+-- Only the SHA-256 hash of each token is kept
+CREATE TABLE api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    name VARCHAR(100) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    token_hash BYTEA NOT NULL CONSTRAINT uc_api_tokens_hash UNIQUE,
+    created TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_api_tokens_user ON api_tokens (user_id);
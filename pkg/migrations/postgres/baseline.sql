@@ -0,0 +1,18 @@
+-- To copy the data of a database created before the migrations existed into the tables of the first migration, once
+-- its snippets and users tables are renamed baseline_snippets and baseline_users. The IDs are kept so the old links
+-- still work, the content of each snippet becomes its single unnamed file, and the slugs are set afterwards
+INSERT INTO users (id, name, email, hashed_password, created)
+    SELECT id, name, email, hashed_password, created FROM baseline_users;
+
+INSERT INTO snippets (id, slug, title, created, expires)
+    SELECT id, CAST(id AS VARCHAR), title, created, expires FROM baseline_snippets;
+
+INSERT INTO snippet_files (snippet_id, position, name, content)
+    SELECT id, 0, '', content FROM baseline_snippets;
+
+DROP TABLE baseline_snippets;
+DROP TABLE baseline_users;
+
+-- The serial columns don't see the copied IDs, so their next values have to be set past them
+SELECT setval(pg_get_serial_sequence('users', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM users), false);
+SELECT setval(pg_get_serial_sequence('snippets', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM snippets), false);
@@ -0,0 +1,8 @@
+DROP TABLE snippet_files_fts;
+DROP TABLE snippets_fts;
+DROP TABLE api_tokens;
+DROP TABLE snippet_revision_files;
+DROP TABLE snippet_revisions;
+DROP TABLE snippet_files;
+DROP TABLE snippets;
+DROP TABLE users;
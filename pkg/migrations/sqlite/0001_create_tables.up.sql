@@ -0,0 +1,95 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL COLLATE NOCASE UNIQUE,
+    hashed_password TEXT NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE TABLE snippets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    user_id INTEGER REFERENCES users (id),
+    title TEXT NOT NULL,
+    visibility TEXT NOT NULL DEFAULT 'public',
+    max_views INTEGER NOT NULL DEFAULT 0,
+    views INTEGER NOT NULL DEFAULT 0,
+    password_hash BLOB,
+    encrypted BOOLEAN NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL
+);
+CREATE INDEX idx_snippets_created ON snippets (created, id);
+CREATE INDEX idx_snippets_user ON snippets (user_id, created, id);
+
+CREATE TABLE snippet_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id),
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    content TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    language_confidence REAL NOT NULL DEFAULT 1,
+    UNIQUE (snippet_id, position)
+);
+
+CREATE TABLE snippet_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id),
+    user_id INTEGER REFERENCES users (id),
+    title TEXT NOT NULL,
+    created DATETIME NOT NULL
+);
+CREATE INDEX idx_snippet_revisions_snippet ON snippet_revisions (snippet_id);
+
+CREATE TABLE snippet_revision_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    revision_id INTEGER NOT NULL REFERENCES snippet_revisions (id),
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    content TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    language_confidence REAL NOT NULL DEFAULT 1,
+    UNIQUE (revision_id, position)
+);
+
+CREATE TABLE api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    name TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    token_hash BLOB NOT NULL UNIQUE,
+    created DATETIME NOT NULL
+);
+CREATE INDEX idx_api_tokens_user ON api_tokens (user_id);
+
+-- The titles and the files are searched through external content FTS5 tables, kept in sync by triggers
+CREATE VIRTUAL TABLE snippets_fts USING fts5 (title, content = 'snippets', content_rowid = 'id');
+-- +begin
+CREATE TRIGGER snippets_fts_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts (rowid, title) VALUES (new.id, new.title);
+END;
+-- +end
+-- +begin
+CREATE TRIGGER snippets_fts_delete AFTER DELETE ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title) VALUES ('delete', old.id, old.title);
+END;
+-- +end
+-- +begin
+CREATE TRIGGER snippets_fts_update AFTER UPDATE OF title ON snippets BEGIN
+    INSERT INTO snippets_fts (snippets_fts, rowid, title) VALUES ('delete', old.id, old.title);
+    INSERT INTO snippets_fts (rowid, title) VALUES (new.id, new.title);
+END;
+-- +end
+
+CREATE VIRTUAL TABLE snippet_files_fts USING fts5 (name, content, content = 'snippet_files', content_rowid = 'id');
+-- +begin
+CREATE TRIGGER snippet_files_fts_insert AFTER INSERT ON snippet_files BEGIN
+    INSERT INTO snippet_files_fts (rowid, name, content) VALUES (new.id, new.name, new.content);
+END;
+-- +end
+-- +begin
+CREATE TRIGGER snippet_files_fts_delete AFTER DELETE ON snippet_files BEGIN
+    INSERT INTO snippet_files_fts (snippet_files_fts, rowid, name, content) VALUES ('delete', old.id, old.name, old.content);
+END;
+-- +end
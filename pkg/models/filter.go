@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("models: invalid cursor")
+
+// A position in a listing of snippets ordered by (created, id), used for keyset pagination
+type Cursor struct {
+	Created time.Time
+	ID      int
+}
+
+// To encode the cursor into an opaque string that can be used in URLs
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.Created.UnixNano(), c.ID)))
+}
+
+// To decode a cursor created by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var nsec int64
+	var id int
+	_, err = fmt.Sscanf(string(b), "%d.%d", &nsec, &id)
+	if err != nil || id < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Created: time.Unix(0, nsec).UTC(), ID: id}, nil
+}
+
+// To hold the conditions used to list snippets, the zero value of a field means no condition
+type SnippetFilter struct {
+	ViewerID      int           // The user doing the listing, who also sees their own unlisted and private snippets
+	UserID        int           // Only the snippets created by this user
+	CreatedFrom   time.Time     // Only the snippets created at or after this time
+	CreatedTo     time.Time     // Only the snippets created before this time
+	ExpiresWithin time.Duration // Only the snippets expiring within this duration from now
+	After         *Cursor       // To return the snippets that come after (are older than) this position
+	Before        *Cursor       // To return the snippets that come before (are newer than) this position
+	Limit         int
+}
+
+// A page of snippets, newest first, with the cursors of the pages around it (nil when there is no such page)
+type SnippetPage struct {
+	Snippets []*Snippet
+	Next     *Cursor
+	Prev     *Cursor
+}
+
+// To build a page from the rows fetched for a filter. The rows must be in the order they were fetched in,
+// that is newest first when paging forward and oldest first when paging back with filter.Before,
+// and hold up to filter.Limit+1 snippets so the presence of one more page can be detected
+func NewSnippetPage(filter SnippetFilter, rows []*Snippet) *SnippetPage {
+	more := len(rows) > filter.Limit
+	rows = rows[:min(len(rows), filter.Limit)]
+
+	backward := filter.Before != nil
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	p := &SnippetPage{Snippets: rows}
+	if len(rows) == 0 {
+		return p
+	}
+
+	first, last := rows[0], rows[len(rows)-1]
+	if (backward && more) || (!backward && filter.After != nil) {
+		p.Prev = &Cursor{Created: first.Created, ID: first.ID}
+	}
+	if (!backward && more) || backward {
+		p.Next = &Cursor{Created: last.Created, ID: last.ID}
+	}
+	return p
+}
@@ -0,0 +1,85 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"snippet-box/pkg/models"
+	"strings"
+)
+
+// The files of the snippets and of their revisions are stored in two tables with the same columns, apart from the ID of
+// the snippet or revision owning them
+const (
+	SnippetFiles  = "snippet_files"
+	RevisionFiles = "snippet_revision_files"
+)
+
+// To insert the files of a snippet or revision into one of the file tables, keeping their order in the position column
+func (d Dialect) InsertFiles(ctx context.Context, tx *sql.Tx, table, owner string, ownerID int, files []*models.File) error {
+	p := d.Placeholder
+	stmt := fmt.Sprintf(`INSERT INTO %s (%s, position, name, content, language, language_confidence)
+		VALUES (%s, %s, %s, %s, %s, %s)`, table, owner, p(1), p(2), p(3), p(4), p(5), p(6))
+	for i, f := range files {
+		_, err := tx.ExecContext(ctx, stmt, ownerID, i, f.Name, f.Content, f.Language, f.LanguageConfidence)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// To read the files of several snippets or revisions from one of the file tables in a single query.
+// It returns the files in order, keyed by the ID of their owner
+func (d Dialect) SelectFiles(ctx context.Context, q Querier, table, owner string, ownerIDs []int) (map[int][]*models.File, error) {
+	files := map[int][]*models.File{}
+	if len(ownerIDs) == 0 {
+		return files, nil
+	}
+
+	placeholders := make([]string, len(ownerIDs))
+	args := make([]interface{}, len(ownerIDs))
+	for i, id := range ownerIDs {
+		placeholders[i] = d.Placeholder(i + 1)
+		args[i] = id
+	}
+
+	stmt := fmt.Sprintf(`SELECT %s, name, content, language, language_confidence FROM %s
+		WHERE %s IN (%s) ORDER BY %s, position`, owner, table, owner, strings.Join(placeholders, ", "), owner)
+	rows, err := q.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ownerID int
+		f := &models.File{}
+		err := rows.Scan(&ownerID, &f.Name, &f.Content, &f.Language, &f.LanguageConfidence)
+		if err != nil {
+			return nil, err
+		}
+		files[ownerID] = append(files[ownerID], f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// To fill in the Files field of the given snippets
+func (d Dialect) WithFiles(ctx context.Context, q Querier, snippets ...*models.Snippet) error {
+	ids := make([]int, len(snippets))
+	for i, s := range snippets {
+		ids[i] = s.ID
+	}
+
+	files, err := d.SelectFiles(ctx, q, SnippetFiles, "snippet_id", ids)
+	if err != nil {
+		return err
+	}
+	for _, s := range snippets {
+		s.Files = files[s.ID]
+	}
+	return nil
+}
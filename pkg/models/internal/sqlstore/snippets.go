@@ -0,0 +1,101 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"snippet-box/pkg/models"
+)
+
+// The columns read by ScanSnippet, in order. Anonymous snippets have no user_id, which is read as 0
+const SnippetColumns = `id, slug, COALESCE(user_id, 0), title, visibility, max_views, views, password_hash, encrypted, created, expires`
+
+// To read the SnippetColumns of a single row into a new snippet struct
+func ScanSnippet(row Scanner) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	err := row.Scan(&s.ID, &s.Slug, &s.UserID, &s.Title, &s.Visibility, &s.MaxViews, &s.Views, &s.HashedPassword, &s.Encrypted, &s.Created, &s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// To copy every row of a snippets result set into a slice of models.Snippet
+func ScanSnippets(rows *sql.Rows) ([]*models.Snippet, error) {
+	// To ensure the sql.Rows result set is always properly closed before returning
+	defer rows.Close()
+	// To initialize an empty slice to hold the models.Snippet objects
+	snippets := []*models.Snippet{}
+	// To iterate through the rows in the result set
+	for rows.Next() {
+		// Create a new Snippet struct from the row
+		s, err := ScanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		// Append it to the slice of snippets
+		snippets = append(snippets, s)
+	}
+	// When the rows.Next() loop finished we call rows.Err() to retrieve any error during iteration
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// If everything is OK then return the Snippets slice
+	return snippets, nil
+}
+
+// To remove a snippet, its files and its revisions as part of a transaction
+func (d Dialect) DeleteSnippet(ctx context.Context, tx *sql.Tx, id int) error {
+	p := d.Placeholder(1)
+	stmts := []string{
+		`DELETE FROM snippet_revision_files WHERE revision_id IN (SELECT id FROM snippet_revisions WHERE snippet_id = ` + p + `)`,
+		`DELETE FROM snippet_revisions WHERE snippet_id = ` + p,
+		`DELETE FROM snippet_files WHERE snippet_id = ` + p,
+		`DELETE FROM snippets WHERE id = ` + p,
+	}
+	for _, stmt := range stmts {
+		_, err := tx.ExecContext(ctx, stmt, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// To return every revision of a snippet with its files, oldest first, with the name of the user who saved it
+func (d Dialect) Revisions(ctx context.Context, q Querier, id int) ([]*models.Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, COALESCE(r.user_id, 0), COALESCE(u.name, ''), r.title, r.created
+		FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.snippet_id = ` + d.Placeholder(1) + ` ORDER BY r.id`
+	rows, err := q.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		rev := &models.Revision{Number: len(revisions) + 1}
+		err := rows.Scan(&rev.ID, &rev.SnippetID, &rev.UserID, &rev.UserName, &rev.Title, &rev.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(revisions))
+	for i, rev := range revisions {
+		ids[i] = rev.ID
+	}
+	files, err := d.SelectFiles(ctx, q, RevisionFiles, "revision_id", ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revisions {
+		rev.Files = files[rev.ID]
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,38 @@
+// Package sqlstore holds the parts of the SQL backends which don't depend on the database: reading snippets, tokens,
+// files and revisions from their rows and the statements which only differ by their placeholders. The mysql, sqlite
+// and postgres packages keep the SQL which differs between the databases
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// The SQL which differs between the databases, for the statements shared by the backends
+type Dialect struct {
+	// To return the placeholder of the nth argument of a statement, counting from 1
+	Placeholder func(n int) string
+}
+
+var (
+	// The dialect of MySQL and SQLite, whose placeholders are all question marks
+	QuestionMarks = Dialect{Placeholder: func(int) string { return "?" }}
+	// The dialect of PostgreSQL, whose placeholders are numbered: $1, $2...
+	Numbered = Dialect{Placeholder: func(n int) string { return "$" + strconv.Itoa(n) }}
+)
+
+// A *sql.DB or a *sql.Tx, so the rows can be read inside or outside of a transaction
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// A *sql.Row or a *sql.Rows
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// To store the ID 0 of an anonymous user as NULL, as there is no such user
+func NullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
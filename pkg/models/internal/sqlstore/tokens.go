@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"snippet-box/pkg/models"
+	"strings"
+)
+
+// The columns read by ScanToken, in order
+const TokenColumns = `id, user_id, name, scopes, created`
+
+// To read the TokenColumns of a single row into a new token struct
+func ScanToken(row Scanner) (*models.Token, error) {
+	t := &models.Token{}
+	var scopes string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.Created)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	return t, nil
+}
+
+// To copy every row of a tokens result set into a slice of models.Token
+func ScanTokens(rows *sql.Rows) ([]*models.Token, error) {
+	defer rows.Close()
+
+	tokens := []*models.Token{}
+	for rows.Next() {
+		t, err := ScanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,536 @@
+// Package storetest checks that a storage backend follows the contract of models.SnippetStore: expiry, counted views
+// of the snippets burnt after reading, visibility, keyset pagination, revisions and the removal of expired snippets,
+// along with the contracts of models.UserStore and models.TokenStore. Each backend runs it from its own tests, so
+// they all keep the same semantics
+package storetest
+
+import (
+	"context"
+	"slices"
+	"snippet-box/pkg/models"
+	"testing"
+	"time"
+)
+
+// The stores of a backend, empty, with a clock the test controls
+type Backend struct {
+	Snippets models.SnippetStore
+	Users    models.UserStore
+	Tokens   models.TokenStore
+	// To set the time the stores take as the current one. It is nil for the backends reading the time from the
+	// database server, which skip the tests that need to move the clock
+	SetNow func(time.Time)
+}
+
+// The time the clock of each test starts at
+var start = time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// To run every test of the contract, each one against new stores from open
+func Run(t *testing.T, open func(t *testing.T) *Backend) {
+	tests := []struct {
+		name  string
+		test  func(t *testing.T, b *Backend)
+		clock bool // Set when the test moves the clock
+	}{
+		{"Expiry", testExpiry, true},
+		{"BurnAfterReading", testBurnAfterReading, false},
+		{"Visibility", testVisibility, false},
+		{"KeysetPagination", testKeysetPagination, false},
+		{"DeleteExpired", testDeleteExpired, true},
+		{"Revisions", testRevisions, false},
+		{"Users", testUsers, false},
+		{"Tokens", testTokens, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := open(t)
+			if b.SetNow == nil && tt.clock {
+				t.Skip("the backend reads the time from the database server")
+			}
+			setNow(b, start)
+			tt.test(t, b)
+		})
+	}
+}
+
+// To set the clock of the backend when it has one, otherwise the time just goes on
+func setNow(b *Backend, now time.Time) {
+	if b.SetNow != nil {
+		b.SetNow(now)
+	}
+}
+
+// To add a user to the stores, returning their ID
+func newUser(t *testing.T, b *Backend, email string) int {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := b.Users.Insert(ctx, "Test", email, "password123"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := b.Users.Authenticate(ctx, email, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// To add a snippet with a single file expiring in the given number of days, returning it as stored
+func newSnippet(t *testing.T, b *Backend, s *models.Snippet, expires int) *models.Snippet {
+	t.Helper()
+
+	if s.Title == "" {
+		s.Title = "Test"
+	}
+	if s.Visibility == "" {
+		s.Visibility = models.VisibilityPublic
+	}
+	s.Files = []*models.File{{Name: "main.go", Content: "package main"}}
+
+	ctx := context.Background()
+	slug, err := b.Snippets.Insert(ctx, s, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := b.Snippets.GetBySlug(ctx, slug, s.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+// To list every snippet the filter matches, following the Next cursors, and return their slugs in order
+func listAll(t *testing.T, b *Backend, filter models.SnippetFilter) []string {
+	t.Helper()
+
+	var slugs []string
+	for {
+		page, err := b.Snippets.List(context.Background(), filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range page.Snippets {
+			slugs = append(slugs, s.Slug)
+		}
+		if page.Next == nil {
+			return slugs
+		}
+		filter.After, filter.Before = page.Next, nil
+	}
+}
+
+func testExpiry(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	s := newSnippet(t, b, &models.Snippet{}, 1)
+	if want := start.AddDate(0, 0, 1); !s.Expires.Equal(want) {
+		t.Errorf("got expiry %v, want %v", s.Expires, want)
+	}
+
+	b.SetNow(start.Add(23 * time.Hour))
+	if _, err := b.Snippets.Get(ctx, s.ID, 0); err != nil {
+		t.Errorf("the snippet is gone before its expiry: %v", err)
+	}
+	if slugs := listAll(t, b, models.SnippetFilter{ExpiresWithin: 2 * time.Hour, Limit: 10}); len(slugs) != 1 {
+		t.Errorf("got %d snippets expiring within 2 hours, want 1", len(slugs))
+	}
+	if slugs := listAll(t, b, models.SnippetFilter{ExpiresWithin: 30 * time.Minute, Limit: 10}); len(slugs) != 0 {
+		t.Errorf("got %d snippets expiring within 30 minutes, want 0", len(slugs))
+	}
+
+	b.SetNow(start.AddDate(0, 0, 1))
+	if _, err := b.Snippets.Get(ctx, s.ID, 0); err != models.ErrNoRecord {
+		t.Errorf("Get of an expired snippet: got %v, want ErrNoRecord", err)
+	}
+	if _, err := b.Snippets.GetBySlug(ctx, s.Slug, 0); err != models.ErrNoRecord {
+		t.Errorf("GetBySlug of an expired snippet: got %v, want ErrNoRecord", err)
+	}
+	if _, err := b.Snippets.View(ctx, s.Slug, 0); err != models.ErrNoRecord {
+		t.Errorf("View of an expired snippet: got %v, want ErrNoRecord", err)
+	}
+	if slugs := listAll(t, b, models.SnippetFilter{Limit: 10}); len(slugs) != 0 {
+		t.Errorf("got %d listed snippets, want the expired one left out", len(slugs))
+	}
+	if found, err := b.Snippets.Search(ctx, "main", 0, 10, 0); err != nil || len(found) != 0 {
+		t.Errorf("got %d search results and error %v, want the expired snippet left out", len(found), err)
+	}
+}
+
+func testBurnAfterReading(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	owner := newUser(t, b, "owner@example.com")
+	reader := newUser(t, b, "reader@example.com")
+	s := newSnippet(t, b, &models.Snippet{UserID: owner, MaxViews: 2}, 1)
+
+	// The views of the owner aren't counted
+	for i := 0; i < 3; i++ {
+		v, err := b.Snippets.View(ctx, s.Slug, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Views != 0 {
+			t.Fatalf("got %d views after a view by the owner, want 0", v.Views)
+		}
+	}
+
+	for i, viewer := range []int{reader, 0} {
+		v, err := b.Snippets.View(ctx, s.Slug, viewer)
+		if err != nil {
+			t.Fatalf("view %d: %v", i+1, err)
+		}
+		if v.Views != i+1 || v.ViewsLeft() != 1-i {
+			t.Errorf("view %d: got %d views and %d left, want %d and %d", i+1, v.Views, v.ViewsLeft(), i+1, 1-i)
+		}
+		if len(v.Files) != 1 {
+			t.Errorf("view %d: got %d files, want the content along with the view", i+1, len(v.Files))
+		}
+	}
+
+	// The last allowed view deleted the snippet with its history, even for its owner
+	if _, err := b.Snippets.View(ctx, s.Slug, reader); err != models.ErrNoRecord {
+		t.Errorf("View after the last allowed view: got %v, want ErrNoRecord", err)
+	}
+	if _, err := b.Snippets.Get(ctx, s.ID, owner); err != models.ErrNoRecord {
+		t.Errorf("Get by the owner after the last allowed view: got %v, want ErrNoRecord", err)
+	}
+	if revisions, err := b.Snippets.Revisions(ctx, s.ID); err != nil || len(revisions) != 0 {
+		t.Errorf("got %d revisions and error %v, want the history deleted", len(revisions), err)
+	}
+}
+
+func testVisibility(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	owner := newUser(t, b, "owner@example.com")
+	other := newUser(t, b, "other@example.com")
+	public := newSnippet(t, b, &models.Snippet{UserID: owner, Visibility: models.VisibilityPublic}, 1)
+	unlisted := newSnippet(t, b, &models.Snippet{UserID: owner, Visibility: models.VisibilityUnlisted}, 1)
+	private := newSnippet(t, b, &models.Snippet{UserID: owner, Visibility: models.VisibilityPrivate}, 1)
+
+	tests := []struct {
+		snippet  *models.Snippet
+		viewerID int
+		readable bool
+		listed   bool
+	}{
+		{public, 0, true, true},
+		{public, other, true, true},
+		{unlisted, 0, true, false},
+		{unlisted, other, true, false},
+		{unlisted, owner, true, true},
+		{private, 0, false, false},
+		{private, other, false, false},
+		{private, owner, true, true},
+	}
+	for _, tt := range tests {
+		_, err := b.Snippets.Get(ctx, tt.snippet.ID, tt.viewerID)
+		if readable := err == nil; readable != tt.readable {
+			t.Errorf("Get of the %s snippet by user %d: got error %v", tt.snippet.Visibility, tt.viewerID, err)
+		}
+		_, err = b.Snippets.View(ctx, tt.snippet.Slug, tt.viewerID)
+		if readable := err == nil; readable != tt.readable {
+			t.Errorf("View of the %s snippet by user %d: got error %v", tt.snippet.Visibility, tt.viewerID, err)
+		}
+		if !tt.readable && err != models.ErrNoRecord {
+			t.Errorf("View of the %s snippet by user %d: got %v, want ErrNoRecord", tt.snippet.Visibility, tt.viewerID, err)
+		}
+
+		listed := false
+		for _, slug := range listAll(t, b, models.SnippetFilter{ViewerID: tt.viewerID, Limit: 10}) {
+			listed = listed || slug == tt.snippet.Slug
+		}
+		if listed != tt.listed {
+			t.Errorf("listing the %s snippet for user %d: got %t, want %t", tt.snippet.Visibility, tt.viewerID, listed, tt.listed)
+		}
+
+		found := false
+		results, err := b.Snippets.Search(ctx, "main", tt.viewerID, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range results {
+			found = found || s.Slug == tt.snippet.Slug
+		}
+		if found != tt.listed {
+			t.Errorf("searching the %s snippet for user %d: got %t, want %t", tt.snippet.Visibility, tt.viewerID, found, tt.listed)
+		}
+	}
+}
+
+func testKeysetPagination(t *testing.T, b *Backend) {
+	// Three snippets share their creation time, so the pages are ordered by ID among them. With the clock of the
+	// database server the times may differ, which gives the same order
+	var want []string
+	for _, offset := range []time.Duration{0, 0, 0, time.Minute, 2 * time.Minute} {
+		setNow(b, start.Add(offset))
+		s := newSnippet(t, b, &models.Snippet{}, 1)
+		want = append([]string{s.Slug}, want...)
+	}
+
+	got := listAll(t, b, models.SnippetFilter{Limit: 2})
+	if !slices.Equal(got, want) {
+		t.Fatalf("paging forward: got %q, want %q", got, want)
+	}
+
+	// Paging back from the last page gives the same pages in reverse
+	filter := models.SnippetFilter{Limit: 2}
+	var pages []*models.SnippetPage
+	for {
+		page, err := b.Snippets.List(context.Background(), filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+		if page.Next == nil {
+			break
+		}
+		filter.After = page.Next
+	}
+	for i := len(pages) - 1; i > 0; i-- {
+		page, err := b.Snippets.List(context.Background(), models.SnippetFilter{Before: pages[i].Prev, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := slugs(page.Snippets), slugs(pages[i-1].Snippets); !slices.Equal(g, w) {
+			t.Errorf("paging back to page %d: got %q, want %q", i, g, w)
+		}
+	}
+	if pages[0].Prev != nil {
+		t.Errorf("the first page has a previous page")
+	}
+}
+
+func testDeleteExpired(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	owner := newUser(t, b, "owner@example.com")
+	var expired []*models.Snippet
+	for days := 1; days <= 3; days++ {
+		expired = append(expired, newSnippet(t, b, &models.Snippet{UserID: owner}, days))
+	}
+	live := newSnippet(t, b, &models.Snippet{UserID: owner}, 5)
+
+	if n, err := b.Snippets.DeleteExpired(ctx, 10); err != nil || n != 0 {
+		t.Fatalf("got %d deleted snippets and error %v before any expiry, want 0", n, err)
+	}
+
+	b.SetNow(start.AddDate(0, 0, 4))
+	for _, want := range []int{2, 1, 0} {
+		n, err := b.Snippets.DeleteExpired(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("got %d deleted snippets, want %d", n, want)
+		}
+	}
+
+	for _, s := range expired {
+		if revisions, err := b.Snippets.Revisions(ctx, s.ID); err != nil || len(revisions) != 0 {
+			t.Errorf("got %d revisions and error %v for a deleted snippet, want none", len(revisions), err)
+		}
+	}
+	if _, err := b.Snippets.Get(ctx, live.ID, owner); err != nil {
+		t.Errorf("Get of the unexpired snippet: %v", err)
+	}
+	if revisions, err := b.Snippets.Revisions(ctx, live.ID); err != nil || len(revisions) != 1 {
+		t.Errorf("got %d revisions and error %v for the unexpired snippet, want 1", len(revisions), err)
+	}
+}
+
+func testRevisions(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	owner := newUser(t, b, "owner@example.com")
+	editor := newUser(t, b, "editor@example.com")
+	s := newSnippet(t, b, &models.Snippet{UserID: owner, Title: "First"}, 1)
+
+	s.Title = "Second"
+	s.Files = []*models.File{{Name: "main.go", Content: "package main\n\nfunc main() {}"}, {Name: "README", Content: "Read me"}}
+	if err := b.Snippets.Update(ctx, s, editor, 0); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := b.Snippets.GetBySlug(ctx, s.Slug, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Title != "Second" || !slices.Equal(contents(updated.Files), contents(s.Files)) {
+		t.Errorf("got %q with the files %q after the update, want %q with %q",
+			updated.Title, contents(updated.Files), s.Title, contents(s.Files))
+	}
+	if !updated.Expires.Equal(s.Expires) {
+		t.Errorf("got expiry %v after an update keeping it, want %v", updated.Expires, s.Expires)
+	}
+
+	revisions, err := b.Snippets.Revisions(ctx, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, want 2", len(revisions))
+	}
+	for i, want := range []struct {
+		title  string
+		userID int
+		files  []string
+	}{
+		{"First", owner, []string{"package main"}},
+		{"Second", editor, contents(s.Files)},
+	} {
+		rev := revisions[i]
+		if rev.Number != i+1 || rev.SnippetID != s.ID || rev.Title != want.title || rev.UserID != want.userID {
+			t.Errorf("got revision %d %q of snippet %d by user %d, want revision %d %q of snippet %d by user %d",
+				rev.Number, rev.Title, rev.SnippetID, rev.UserID, i+1, want.title, s.ID, want.userID)
+		}
+		if rev.UserName != "Test" {
+			t.Errorf("got the author name %q for revision %d, want %q", rev.UserName, i+1, "Test")
+		}
+		if !slices.Equal(contents(rev.Files), want.files) {
+			t.Errorf("got the files %q for revision %d, want %q", contents(rev.Files), i+1, want.files)
+		}
+	}
+
+	// Restoring the first revision saves its title and files as a new one
+	s.Title, s.Files = revisions[0].Title, revisions[0].Files
+	if err = b.Snippets.Update(ctx, s, owner, 0); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := b.Snippets.GetBySlug(ctx, s.Slug, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "First" || !slices.Equal(contents(restored.Files), []string{"package main"}) {
+		t.Errorf("got %q with the files %q after the restore, want the first revision", restored.Title, contents(restored.Files))
+	}
+	revisions, err = b.Snippets.Revisions(ctx, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[2].Title != "First" || revisions[2].UserID != owner {
+		t.Errorf("got %d revisions after the restore, want a third one by the owner", len(revisions))
+	}
+
+	if b.SetNow != nil {
+		if err = b.Snippets.Update(ctx, s, owner, 3); err != nil {
+			t.Fatal(err)
+		}
+		updated, err = b.Snippets.GetBySlug(ctx, s.Slug, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := start.AddDate(0, 0, 3); !updated.Expires.Equal(want) {
+			t.Errorf("got expiry %v after an update setting it, want %v", updated.Expires, want)
+		}
+	}
+}
+
+func testUsers(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	id := newUser(t, b, "alice@example.com")
+
+	// The email addresses are unique without case
+	for _, email := range []string{"alice@example.com", "Alice@Example.COM"} {
+		if err := b.Users.Insert(ctx, "Other", email, "password456"); err != models.ErrDuplicateEmail {
+			t.Errorf("Insert with the email %q: got %v, want ErrDuplicateEmail", email, err)
+		}
+	}
+
+	u, err := b.Users.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != id || u.Name != "Test" || u.Email != "alice@example.com" {
+		t.Errorf("got user %d %q <%s>, want user %d %q <alice@example.com>", u.ID, u.Name, u.Email, id, "Test")
+	}
+	if _, err = b.Users.Get(ctx, id+1000); err != models.ErrNoRecord {
+		t.Errorf("Get of a missing user: got %v, want ErrNoRecord", err)
+	}
+
+	tests := []struct {
+		email    string
+		password string
+		err      error
+	}{
+		{"alice@example.com", "password123", nil},
+		{"ALICE@example.com", "password123", nil},
+		{"alice@example.com", "wrong password", models.ErrInvalidCredentials},
+		{"bob@example.com", "password123", models.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		got, err := b.Users.Authenticate(ctx, tt.email, tt.password)
+		if err != tt.err || (err == nil && got != id) {
+			t.Errorf("Authenticate(%q, %q): got user %d and error %v, want user %d and error %v",
+				tt.email, tt.password, got, err, id, tt.err)
+		}
+	}
+}
+
+func testTokens(t *testing.T, b *Backend) {
+	ctx := context.Background()
+	owner := newUser(t, b, "owner@example.com")
+	other := newUser(t, b, "other@example.com")
+
+	first, err := b.Tokens.Insert(ctx, owner, "laptop", []string{models.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(b, start.Add(time.Minute))
+	second, err := b.Tokens.Insert(ctx, owner, "ci", []string{models.ScopeRead, models.ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := b.Tokens.ByUser(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0].Name != "ci" || tokens[1].Name != "laptop" {
+		t.Fatalf("got %d tokens, want ci then laptop", len(tokens))
+	}
+	if tokens, err := b.Tokens.ByUser(ctx, other); err != nil || len(tokens) != 0 {
+		t.Errorf("got %d tokens and error %v for a user without any, want none", len(tokens), err)
+	}
+
+	tok, err := b.Tokens.Authenticate(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ID != tokens[0].ID || tok.UserID != owner || !tok.HasScope(models.ScopeWrite) || tok.HasScope(models.ScopeDelete) {
+		t.Errorf("got token %d of user %d with the scopes %q, want token %d of user %d with read and write",
+			tok.ID, tok.UserID, tok.Scopes, tokens[0].ID, owner)
+	}
+	if _, err = b.Tokens.Authenticate(ctx, "sbx_unknown"); err != models.ErrInvalidCredentials {
+		t.Errorf("Authenticate with an unknown token: got %v, want ErrInvalidCredentials", err)
+	}
+
+	// Only the owner can revoke a token
+	if err = b.Tokens.Revoke(ctx, tok.ID, other); err != models.ErrNoRecord {
+		t.Errorf("Revoke by another user: got %v, want ErrNoRecord", err)
+	}
+	if err = b.Tokens.Revoke(ctx, tok.ID, owner); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Tokens.Revoke(ctx, tok.ID, owner); err != models.ErrNoRecord {
+		t.Errorf("Revoke of a revoked token: got %v, want ErrNoRecord", err)
+	}
+	if _, err = b.Tokens.Authenticate(ctx, second); err != models.ErrInvalidCredentials {
+		t.Errorf("Authenticate with a revoked token: got %v, want ErrInvalidCredentials", err)
+	}
+	if tok, err := b.Tokens.Authenticate(ctx, first); err != nil || tok.Name != "laptop" {
+		t.Errorf("Authenticate with the token left: got error %v", err)
+	}
+}
+
+// To return the contents of the files, in order
+func contents(files []*models.File) []string {
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.Content
+	}
+	return out
+}
+
+// To return the slugs of the snippets, in order
+func slugs(snippets []*models.Snippet) []string {
+	out := make([]string, len(snippets))
+	for i, s := range snippets {
+		out[i] = s.Slug
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+// Package memory keeps the snippets, users and API tokens in memory, with the same semantics as the database
+// backends. It is used to run the application without a database server, and everything is lost when it stops
+package memory
+
+import (
+	"snippet-box/pkg/models"
+	"sync"
+	"time"
+)
+
+// To hold all the records, like the tables of a database. The models share a DB the way the database backends share
+// a connection pool
+type DB struct {
+	mu        sync.Mutex
+	snippets  map[int]*models.Snippet
+	revisions map[int][]*models.Revision // The revisions of each snippet, keyed by snippet ID
+	users     map[int]*models.User
+	tokens    map[int]*token
+	lastID    int // The last ID given to a record, the IDs are shared by all the records
+	now       func() time.Time
+}
+
+// A stored API token, with the hash of the token
+type token struct {
+	models.Token
+	hash []byte
+}
+
+// To create an empty DB
+func New() *DB {
+	return &DB{
+		snippets:  map[int]*models.Snippet{},
+		revisions: map[int][]*models.Revision{},
+		users:     map[int]*models.User{},
+		tokens:    map[int]*token{},
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// To return a new record ID, the caller must hold the lock
+func (db *DB) nextID() int {
+	db.lastID++
+	return db.lastID
+}
+
+// To copy files, so the stored ones can't be changed by the callers
+func copyFiles(files []*models.File) []*models.File {
+	if files == nil {
+		return nil
+	}
+	out := make([]*models.File, len(files))
+	for i, f := range files {
+		c := *f
+		out[i] = &c
+	}
+	return out
+}
+
+// To copy a snippet with its files
+func copySnippet(s *models.Snippet) *models.Snippet {
+	c := *s
+	c.Files = copyFiles(s.Files)
+	return &c
+}
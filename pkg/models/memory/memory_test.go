@@ -0,0 +1,21 @@
+package memory
+
+import (
+	"snippet-box/pkg/models/internal/storetest"
+	"testing"
+	"time"
+)
+
+func TestStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *storetest.Backend {
+		db := New()
+		var now time.Time
+		db.now = func() time.Time { return now }
+		return &storetest.Backend{
+			Snippets: &SnippetModel{DB: db},
+			Users:    &UserModel{DB: db},
+			Tokens:   &TokenModel{DB: db},
+			SetNow:   func(t time.Time) { now = t },
+		}
+	})
+}
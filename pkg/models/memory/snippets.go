@@ -0,0 +1,310 @@
+package memory
+
+import (
+	"context"
+	"snippet-box/pkg/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// To define a SnippetModel type that keeps the snippets, with their files and revisions, in a DB
+type SnippetModel struct {
+	DB *DB
+}
+
+// To insert a new snippet along with its first revision. The UserID, Title, Files, Visibility, MaxViews,
+// HashedPassword and Encrypted fields of s are saved, and the snippet expires in the given number of days.
+// It returns the random slug identifying the new snippet
+func (m *SnippetModel) Insert(ctx context.Context, s *models.Snippet, expires int) (string, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	// To draw slugs until one isn't taken, the lock makes the check and the insert atomic
+	var slug string
+	for slug == "" || m.bySlug(slug) != nil {
+		var err error
+		slug, err = models.NewSlug()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	now := m.DB.now()
+	stored := copySnippet(s)
+	stored.ID = m.DB.nextID()
+	stored.Slug = slug
+	stored.Views = 0
+	stored.Created = now
+	stored.Expires = now.AddDate(0, 0, expires)
+	m.DB.snippets[stored.ID] = stored
+
+	m.addRevision(stored.ID, s.UserID, s.Title, s.Files)
+	return slug, nil
+}
+
+// To save the Title, Files and Visibility fields of an existing snippet and keep the result as a new revision
+// saved by the user with editorID. An expires value of 0 keeps the current expiry date
+func (m *SnippetModel) Update(ctx context.Context, s *models.Snippet, editorID, expires int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	// Like an UPDATE matching no row, a missing snippet isn't an error
+	stored, ok := m.DB.snippets[s.ID]
+	if !ok {
+		return nil
+	}
+	stored.Title = s.Title
+	stored.Visibility = s.Visibility
+	stored.Files = copyFiles(s.Files)
+	if expires != 0 {
+		stored.Expires = m.DB.now().AddDate(0, 0, expires)
+	}
+
+	m.addRevision(s.ID, editorID, s.Title, s.Files)
+	return nil
+}
+
+// To permanently remove a snippet and its revisions
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.delete(id)
+	return nil
+}
+
+// To permanently remove up to limit expired snippets, the ones which expired first, with their revisions.
+// It returns how many snippets were removed, fewer than limit once there is no expired snippet left
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	var expired []*models.Snippet
+	for _, s := range m.DB.snippets {
+		if !m.live(s) {
+			expired = append(expired, s)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Expires.Before(expired[j].Expires) })
+	expired = expired[:min(len(expired), limit)]
+
+	for _, s := range expired {
+		m.delete(s.ID)
+	}
+	return len(expired), nil
+}
+
+// To remove a snippet and its revisions, the caller must hold the lock
+func (m *SnippetModel) delete(id int) {
+	delete(m.DB.snippets, id)
+	delete(m.DB.revisions, id)
+}
+
+// To fetch a snippet by its slug for reading its content, with the same visibility rules as Get.
+// Views by anyone but the owner are counted, and a snippet with a view limit is deleted along with its last allowed view
+func (m *SnippetModel) View(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	stored := m.bySlug(slug)
+	if stored == nil || !m.live(stored) || !stored.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+	if stored.MaxViews == 0 || stored.OwnedBy(viewerID) {
+		return copySnippet(stored), nil
+	}
+
+	stored.Views++
+	s := copySnippet(stored)
+	if s.Burned() {
+		m.delete(s.ID)
+	}
+	return s, nil
+}
+
+// To return every revision of a snippet with its files, oldest first, with the name of the user who saved it
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*models.Revision, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	revisions := []*models.Revision{}
+	for _, rev := range m.DB.revisions[id] {
+		c := *rev
+		c.Files = copyFiles(rev.Files)
+		if u, ok := m.DB.users[c.UserID]; ok {
+			c.UserName = u.Name
+		}
+		revisions = append(revisions, &c)
+	}
+	return revisions, nil
+}
+
+// To record a snapshot of a snippet's title and files, the caller must hold the lock
+func (m *SnippetModel) addRevision(snippetID, userID int, title string, files []*models.File) {
+	rev := &models.Revision{
+		ID:        m.DB.nextID(),
+		Number:    len(m.DB.revisions[snippetID]) + 1,
+		SnippetID: snippetID,
+		UserID:    userID,
+		Title:     title,
+		Files:     copyFiles(files),
+		Created:   m.DB.now(),
+	}
+	m.DB.revisions[snippetID] = append(m.DB.revisions[snippetID], rev)
+}
+
+// To fetch a specific snippet by its slug, with the same visibility rules as Get
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s := m.bySlug(slug)
+	if s == nil || !m.live(s) || !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+	return copySnippet(s), nil
+}
+
+// To fetch a specific snippet by ID, as seen by the user with viewerID (0 for anonymous users).
+// Private snippets of other users are reported as not found, so their existence isn't revealed
+func (m *SnippetModel) Get(ctx context.Context, id, viewerID int) (*models.Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok || !m.live(s) || !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+	return copySnippet(s), nil
+}
+
+// To return the stored snippet with the given slug, or nil. The caller must hold the lock
+func (m *SnippetModel) bySlug(slug string) *models.Snippet {
+	for _, s := range m.DB.snippets {
+		if s.Slug == slug {
+			return s
+		}
+	}
+	return nil
+}
+
+// To check that a snippet hasn't expired yet
+func (m *SnippetModel) live(s *models.Snippet) bool {
+	return s.Expires.After(m.DB.now())
+}
+
+// To return one page of the unexpired snippets matching the filter, newest first, using keyset pagination on (created, id).
+// Like the database backends, the snippets of a listing don't have their files
+func (m *SnippetModel) List(ctx context.Context, filter models.SnippetFilter) (*models.SnippetPage, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	now := m.DB.now()
+	var rows []*models.Snippet
+	for _, s := range m.DB.snippets {
+		switch {
+		case !m.live(s):
+		case s.Visibility != models.VisibilityPublic && !s.OwnedBy(filter.ViewerID):
+		case filter.UserID != 0 && s.UserID != filter.UserID:
+		case !filter.CreatedFrom.IsZero() && s.Created.Before(filter.CreatedFrom):
+		case !filter.CreatedTo.IsZero() && !s.Created.Before(filter.CreatedTo):
+		case filter.ExpiresWithin > 0 && s.Expires.After(now.Add(filter.ExpiresWithin)):
+		case filter.After != nil && !newer(*filter.After, position(s)):
+		case filter.Before != nil && !newer(position(s), *filter.Before):
+		default:
+			c := *s
+			c.Files = nil
+			rows = append(rows, &c)
+		}
+	}
+
+	// Paging back means reading the newer rows in ascending order, they are put back in order by NewSnippetPage
+	sort.Slice(rows, func(i, j int) bool {
+		if filter.Before != nil {
+			return newer(position(rows[j]), position(rows[i]))
+		}
+		return newer(position(rows[i]), position(rows[j]))
+	})
+	rows = rows[:min(len(rows), filter.Limit+1)]
+
+	return models.NewSnippetPage(filter, rows), nil
+}
+
+// To check if a comes before b in a listing, that is if it is newer, comparing the (created, id) positions
+func newer(a, b models.Cursor) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.After(b.Created)
+	}
+	return a.ID > b.ID
+}
+
+// To return the position of a snippet in listings
+func position(s *models.Snippet) models.Cursor {
+	return models.Cursor{Created: s.Created, ID: s.ID}
+}
+
+// To search the title and files of the unexpired snippets, best matches first. The score of a snippet is the number
+// of times the words of the query appear in its title, plus the number of times they appear in its best matching file.
+// Like the database backends, only public snippets without a view limit, password or encryption are searched, plus
+// those belonging to the viewer
+func (m *SnippetModel) Search(ctx context.Context, query string, viewerID, limit, offset int) ([]*models.Snippet, error) {
+	words := searchWords(query)
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	type result struct {
+		s     *models.Snippet
+		score int
+	}
+	var results []result
+	for _, s := range m.DB.snippets {
+		own := s.OwnedBy(viewerID)
+		searchable := s.Visibility == models.VisibilityPublic && s.MaxViews == 0 && !s.Protected() && !s.Encrypted
+		if !m.live(s) || !(own || searchable) {
+			continue
+		}
+
+		best := 0
+		for _, f := range s.Files {
+			best = max(best, matches(words, f.Name+" "+f.Content))
+		}
+		if score := matches(words, s.Title) + best; score > 0 {
+			results = append(results, result{copySnippet(s), score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return newer(position(results[i].s), position(results[j].s))
+	})
+
+	snippets := []*models.Snippet{}
+	for i := offset; i < len(results) && len(snippets) < limit; i++ {
+		snippets = append(snippets, results[i].s)
+	}
+	return snippets, nil
+}
+
+// To split a search query into lower case words
+func searchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// To count how many times the words appear as whole words in a text
+func matches(words []string, text string) int {
+	n := 0
+	for _, w := range searchWords(text) {
+		for _, q := range words {
+			if w == q {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"snippet-box/pkg/models"
+	"sort"
+)
+
+// To define a TokenModel type that keeps the personal API tokens in a DB
+type TokenModel struct {
+	DB *DB
+}
+
+// To create a new API token for a user, with a name and scopes. It returns the token, only its hash is stored
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string, scopes []string) (string, error) {
+	t, hash, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	id := m.DB.nextID()
+	m.DB.tokens[id] = &token{
+		Token: models.Token{ID: id, UserID: userID, Name: name, Scopes: append([]string(nil), scopes...), Created: m.DB.now()},
+		hash:  hash,
+	}
+	return t, nil
+}
+
+// To return the API tokens of a user, newest first
+func (m *TokenModel) ByUser(ctx context.Context, userID int) ([]*models.Token, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	tokens := []*models.Token{}
+	for _, t := range m.DB.tokens {
+		if t.UserID == userID {
+			c := t.Token
+			tokens = append(tokens, &c)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].Created.Equal(tokens[j].Created) {
+			return tokens[i].Created.After(tokens[j].Created)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// To revoke an API token of a user, returning ErrNoRecord when the user has no token with this ID
+func (m *TokenModel) Revoke(ctx context.Context, id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t, ok := m.DB.tokens[id]
+	if !ok || t.UserID != userID {
+		return models.ErrNoRecord
+	}
+	delete(m.DB.tokens, id)
+	return nil
+}
+
+// To return the API token matching the token given in a request, or ErrInvalidCredentials when there is none
+func (m *TokenModel) Authenticate(ctx context.Context, tok string) (*models.Token, error) {
+	hash := models.HashToken(tok)
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, t := range m.DB.tokens {
+		if bytes.Equal(t.hash, hash) {
+			c := t.Token
+			return &c, nil
+		}
+	}
+	return nil, models.ErrInvalidCredentials
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"snippet-box/pkg/models"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// To define a UserModel type that keeps the users in a DB
+type UserModel struct {
+	DB *DB
+}
+
+// To add a new user. Email addresses are compared without case, like the unique constraint of the users table
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if m.byEmail(email) != nil {
+		return models.ErrDuplicateEmail
+	}
+	id := m.DB.nextID()
+	m.DB.users[id] = &models.User{ID: id, Name: name, Email: email, HashedPassword: hashedPassword, Created: m.DB.now()}
+	return nil
+}
+
+// To return the user with the given email address, or nil. The caller must hold the lock
+func (m *UserModel) byEmail(email string) *models.User {
+	for _, u := range m.DB.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+// To verify if user exist, and return user ID if user exist
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	m.DB.mu.Lock()
+	u := m.byEmail(email)
+	m.DB.mu.Unlock()
+	if u == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
+
+// To get the details of a specific user, without the password hash
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	u, ok := m.DB.users[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return &models.User{ID: u.ID, Name: u.Name, Email: u.Email, Created: u.Created}, nil
+}
@@ -2,7 +2,10 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -11,12 +14,106 @@ var (
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
 )
 
+// The visibility levels of a snippet
+const (
+	VisibilityPublic   = "public"   // Listed and searchable by everyone
+	VisibilityUnlisted = "unlisted" // Not listed, only reachable by the people who have its URL
+	VisibilityPrivate  = "private"  // Only readable by its owner
+)
+
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	Slug       string // Random identifier used in the snippet's URL
+	UserID     int    // ID of the user who created the snippet, 0 for an anonymous snippet
+	Title      string
+	Files      []*File // The files making up the snippet, in the order they are shown
+	Visibility string
+	MaxViews   int // The snippet is deleted once it has been viewed this many times, 0 means no limit
+	Views      int // The number of counted views so far
+	// The bcrypt hash of the password needed to read the snippet, nil when it isn't password protected
+	HashedPassword []byte
+	// Set when the content was encrypted in the browser, the server then only holds opaque ciphertext
+	Encrypted bool
+	Created   time.Time
+	Expires   time.Time
+}
+
+// To return the file with the given name, or nil if the snippet has none
+func (s *Snippet) File(name string) *File {
+	for _, f := range s.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// To return the content of all the files, one after the other, e.g. to show an excerpt of the snippet
+func (s *Snippet) Text() string {
+	contents := make([]string, len(s.Files))
+	for i, f := range s.Files {
+		contents[i] = f.Content
+	}
+	return strings.Join(contents, "\n")
+}
+
+// To check if the snippet was deleted by its last allowed view, so the current view is the final one
+func (s *Snippet) Burned() bool {
+	return s.MaxViews > 0 && s.Views >= s.MaxViews
+}
+
+// To check if the snippet needs a password to be read
+func (s *Snippet) Protected() bool {
+	return len(s.HashedPassword) > 0
+}
+
+// To check the password given to unlock the snippet, returning ErrInvalidCredentials when it doesn't match
+func (s *Snippet) CheckPassword(password string) error {
+	err := bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// To return the number of views the snippet has left before it is deleted, 0 if it is not burnt after reading
+func (s *Snippet) ViewsLeft() int {
+	if s.MaxViews == 0 {
+		return 0
+	}
+	return max(s.MaxViews-s.Views, 0)
+}
+
+// To check if the user with the given ID (0 for anonymous users) is the owner of the snippet. Nobody owns an
+// anonymous snippet, so an anonymous user never owns one
+func (s *Snippet) OwnedBy(userID int) bool {
+	return userID != 0 && s.UserID == userID
+}
+
+// To check if the user with the given ID (0 for anonymous users) is allowed to read the snippet
+func (s *Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != VisibilityPrivate || s.OwnedBy(userID)
+}
+
+// A named file of a snippet, or of one of its revisions
+type File struct {
+	Name     string // Unique within the snippet, e.g. "main.go"
+	Content  string
+	Language string // The language used to highlight the content, empty for plain text
+	// How sure the automatic detection was about Language, from 0 to 1. It is 1 when the user picked the language
+	LanguageConfidence float64
+}
+
+// A saved version of a snippet's title and files, along with the user who saved it
+type Revision struct {
+	ID        int
+	Number    int // Position of the revision in the snippet's history, starting at 1
+	SnippetID int
+	UserID    int
+	UserName  string
+	Title     string
+	Files     []*File
+	Created   time.Time
 }
 
 type User struct {
@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"snippet-box/pkg/migrations"
+	"snippet-box/pkg/models/internal/storetest"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// The tests need a MySQL server, they run against the database of the SNIPPETBOX_TEST_MYSQL_DSN environment variable,
+// e.g. "test:pass@/snippetbox_test?parseTime=true", and are skipped without it. Its tables are dropped after each
+// test, so it must be a database used only by the tests
+func TestStoreContract(t *testing.T) {
+	dsn := os.Getenv("SNIPPETBOX_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_MYSQL_DSN isn't set")
+	}
+
+	storetest.Run(t, func(t *testing.T) *storetest.Backend {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		ctx := context.Background()
+		migrator, err := migrations.New(db, "mysql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// To revert every migration once the test is done, even a failed Up, leaving the database empty
+		t.Cleanup(func() {
+			for {
+				m, err := migrator.Down(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				if m == nil || err != nil {
+					return
+				}
+			}
+		})
+		if _, err = migrator.Up(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		return &storetest.Backend{
+			Snippets: &SnippetModel{DB: db},
+			Users:    &UserModel{DB: db},
+			Tokens:   &TokenModel{DB: db},
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"snippet-box/pkg/models"
 	"strings"
@@ -14,7 +15,7 @@ type UserModel struct {
 }
 
 // To add a new record to the users table in the DB
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
 	// To Create a bcrypt hash of the password text
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
@@ -23,25 +24,29 @@ func (m *UserModel) Insert(name, email, password string) error {
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
 
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
-	if err != nil {
-		// To check if the error is a MySQL-specific error.
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
-			// To check if the error code is 1062 (Duplicate entry) and if the error message contains 'u' (for unique email constraint).
-			if mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, "users.uc_users_email") {
-				return models.ErrDuplicateEmail
-			}
-		}
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if isDuplicate(err, "users.uc_users_email") {
+		return models.ErrDuplicateEmail
 	}
 	return err
 }
 
+// To check if err is a MySQL "Duplicate entry" error for the given unique constraint
+func isDuplicate(err error, constraint string) bool {
+	// To check if the error is a MySQL-specific error.
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		// To check if the error code is 1062 (Duplicate entry) and if the error message contains the constraint name
+		return mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, constraint)
+	}
+	return false
+}
+
 // To verify if user exist, and return user ID if user exist
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	// To retrieve the user id and hashed password
 	var id int
 	var hashedPassword []byte
-	row := m.DB.QueryRow("SELECT id, hashed_password FROM users WHERE email = ?", email)
+	row := m.DB.QueryRowContext(ctx, "SELECT id, hashed_password FROM users WHERE email = ?", email)
 	err := row.Scan(&id, &hashedPassword)
 	if err == sql.ErrNoRows {
 		return 0, models.ErrInvalidCredentials
@@ -62,11 +67,11 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 }
 
 // To get the details of a specific user
-func (m *UserModel) Get(id int) (*models.User, error) {
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
 	s := &models.User{}
 
 	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
-	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Name, &s.Email, &s.Created)
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&s.ID, &s.Name, &s.Email, &s.Created)
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNoRecord
 	} else if err != nil {
@@ -0,0 +1,355 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"snippet-box/pkg/models"
+	"snippet-box/pkg/models/internal/sqlstore"
+	"strings"
+	"unicode"
+)
+
+// To define a SnippetModel type that wraps a sql.DB connection pool
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+// The number of times Insert tries a new random slug when the generated one is already taken
+const slugAttempts = 5
+
+// The dialect of the statements shared with the other SQL backends
+var dialect = sqlstore.Numbered
+
+// To insert a new snippet into the database, along with its files and first revision. The UserID, Title, Files, Visibility,
+// MaxViews, HashedPassword and Encrypted fields of s are saved, and the snippet expires in the given number of days.
+// A UserID of 0 makes an anonymous snippet, which nobody owns.
+// It returns the random slug identifying the new snippet
+func (m *SnippetModel) Insert(ctx context.Context, s *models.Snippet, expires int) (string, error) {
+	// To run all the inserts in a transaction, so a snippet never exists without its files and history
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// The SQL statement to be executed, it returns the ID of the new row as PostgreSQL has no LastInsertId
+	stmt := `INSERT INTO snippets (slug, user_id, title, visibility, max_views, views, password_hash, encrypted, created, expires)
+		 VALUES ($1, $2, $3, $4, $5, 0, $6, $7, NOW(), NOW() + make_interval(days => $8)) RETURNING id`
+
+	var slug string
+	var id int
+	for i := 0; i < slugAttempts; i++ {
+		slug, err = models.NewSlug()
+		if err != nil {
+			return "", err
+		}
+		// A failed statement aborts the whole transaction, so each attempt runs in a savepoint it can be rolled back to
+		_, err = tx.ExecContext(ctx, `SAVEPOINT insert_slug`)
+		if err != nil {
+			return "", err
+		}
+		// To execute the statement, trying again with another slug if this one collides with an existing snippet
+		err = tx.QueryRowContext(ctx, stmt, slug, sqlstore.NullID(s.UserID), s.Title, s.Visibility, s.MaxViews, s.HashedPassword, s.Encrypted, expires).Scan(&id)
+		if !isDuplicate(err, "uc_snippets_slug") {
+			break
+		}
+		if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT insert_slug`); rbErr != nil {
+			return "", rbErr
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = dialect.InsertFiles(ctx, tx, sqlstore.SnippetFiles, "snippet_id", id, s.Files)
+	if err != nil {
+		return "", err
+	}
+	err = insertRevision(ctx, tx, id, s.UserID, s.Title, s.Files)
+	if err != nil {
+		return "", err
+	}
+
+	return slug, tx.Commit()
+}
+
+// To save the Title, Files and Visibility fields of an existing snippet and keep the result as a new revision
+// saved by the user with editorID. An expires value of 0 keeps the current expiry date
+func (m *SnippetModel) Update(ctx context.Context, s *models.Snippet, editorID, expires int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = $1, visibility = $2,
+		expires = CASE WHEN $3 = 0 THEN expires ELSE NOW() + make_interval(days => $3) END WHERE id = $4`
+	_, err = tx.ExecContext(ctx, stmt, s.Title, s.Visibility, expires, s.ID)
+	if err != nil {
+		return err
+	}
+
+	// The files are replaced as a whole, the previous ones are still kept in the revisions
+	_, err = tx.ExecContext(ctx, `DELETE FROM snippet_files WHERE snippet_id = $1`, s.ID)
+	if err != nil {
+		return err
+	}
+	err = dialect.InsertFiles(ctx, tx, sqlstore.SnippetFiles, "snippet_id", s.ID, s.Files)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, s.ID, editorID, s.Title, s.Files)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// To permanently remove a snippet and its revisions from the database
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = dialect.DeleteSnippet(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// To permanently remove up to limit expired snippets, the ones which expired first, with their files and revisions.
+// It returns how many snippets were removed, fewer than limit once there is no expired snippet left
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The rows locked by another transaction, e.g. the reaper of another instance of the application, are left for later
+	stmt := `SELECT id FROM snippets WHERE expires <= NOW() ORDER BY expires LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, stmt, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err = dialect.DeleteSnippet(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// To fetch a snippet by its slug for reading its content, with the same visibility rules as Get.
+// Views by anyone but the owner are counted, and a snippet with a view limit is deleted in the same transaction
+// as its last allowed view, so it can never be read more times than its limit
+func (m *SnippetModel) View(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// To lock the row, so concurrent views are counted one after the other
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > NOW() AND slug = $1 FOR UPDATE`
+	s, err := sqlstore.ScanSnippet(tx.QueryRowContext(ctx, stmt, slug))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	// The files are read before the last view of a burn after reading snippet deletes them
+	err = dialect.WithFiles(ctx, tx, s)
+	if err != nil {
+		return nil, err
+	}
+	if s.MaxViews == 0 || s.OwnedBy(viewerID) {
+		return s, nil
+	}
+
+	s.Views++
+	if s.Burned() {
+		err = dialect.DeleteSnippet(ctx, tx, s.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE snippets SET views = $1 WHERE id = $2`, s.Views, s.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, tx.Commit()
+}
+
+// To return every revision of a snippet with its files, oldest first, with the name of the user who saved it
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*models.Revision, error) {
+	return dialect.Revisions(ctx, m.DB, id)
+}
+
+// To record a snapshot of a snippet's title and files in the snippet_revisions and snippet_revision_files tables
+func insertRevision(ctx context.Context, tx *sql.Tx, snippetID, userID int, title string, files []*models.File) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, user_id, title, created)
+		VALUES ($1, $2, $3, NOW()) RETURNING id`
+	var id int
+	err := tx.QueryRowContext(ctx, stmt, snippetID, sqlstore.NullID(userID), title).Scan(&id)
+	if err != nil {
+		return err
+	}
+	return dialect.InsertFiles(ctx, tx, sqlstore.RevisionFiles, "revision_id", id, files)
+}
+
+// To fetch a specific snippet by its slug, with the same visibility rules as Get
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > NOW() AND slug = $1`
+	s, err := sqlstore.ScanSnippet(m.DB.QueryRowContext(ctx, stmt, slug))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	return s, dialect.WithFiles(ctx, m.DB, s)
+}
+
+// To fetch a specific snippet by ID, as seen by the user with viewerID (0 for anonymous users).
+// Private snippets of other users are reported as not found, so their existence isn't revealed
+func (m *SnippetModel) Get(ctx context.Context, id, viewerID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > NOW() and id = $1`
+	// To execute the SQL statement with the QueryRow method on the connection pool
+	row := m.DB.QueryRowContext(ctx, stmt, id)
+	// To copy the values from each field in sql.Row to a new snippet struct
+	s, err := sqlstore.ScanSnippet(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	// If everything goes OK then return the Snippet object, along with its files
+	return s, dialect.WithFiles(ctx, m.DB, s)
+}
+
+// To return one page of the unexpired snippets matching the filter, newest first, using keyset pagination on (created, id)
+func (m *SnippetModel) List(ctx context.Context, filter models.SnippetFilter) (*models.SnippetPage, error) {
+	// To build the WHERE clause from the conditions set in the filter, arg adds a value and returns its placeholder.
+	// Only public snippets are listed unless they belong to the viewer
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	viewer := arg(filter.ViewerID)
+	where := []string{"expires > NOW()", "(visibility = 'public' OR (" + viewer + " <> 0 AND user_id = " + viewer + "))"}
+
+	if filter.UserID != 0 {
+		where = append(where, "user_id = "+arg(filter.UserID))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, "created >= "+arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, "created < "+arg(filter.CreatedTo))
+	}
+	if filter.ExpiresWithin > 0 {
+		where = append(where, "expires <= NOW() + make_interval(secs => "+arg(filter.ExpiresWithin.Seconds())+")")
+	}
+
+	// Paging back means reading the newer rows in ascending order, they are put back in order by NewSnippetPage
+	order := "DESC"
+	if c := filter.After; c != nil {
+		where = append(where, fmt.Sprintf("(created, id) < (%s, %s)", arg(c.Created), arg(c.ID)))
+	} else if c := filter.Before; c != nil {
+		where = append(where, fmt.Sprintf("(created, id) > (%s, %s)", arg(c.Created), arg(c.ID)))
+		order = "ASC"
+	}
+
+	// One more row than needed is fetched to know if there is another page
+	stmt := fmt.Sprintf(`SELECT `+sqlstore.SnippetColumns+` FROM snippets
+		WHERE %s ORDER BY created %s, id %s LIMIT %s`, strings.Join(where, " AND "), order, order, arg(filter.Limit+1))
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := sqlstore.ScanSnippets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewSnippetPage(filter, snippets), nil
+}
+
+// To search the title and files of the unexpired snippets, best matches first, using the tsvector columns indexing
+// the titles and the names and content of the files, up to the first 200000 characters of each file.
+// Like listings, only public snippets are searched, plus those belonging to the viewer. Snippets with a view limit
+// or a password are left out, as the search excerpts would show their content without a counted view or an unlock,
+// and so are the encrypted snippets since their content is only ciphertext
+func (m *SnippetModel) Search(ctx context.Context, query string, viewerID, limit, offset int) ([]*models.Snippet, error) {
+	match := tsQuery(query)
+	if match == "" {
+		return []*models.Snippet{}, nil
+	}
+
+	// The score of a snippet is the rank of its title plus the one of its best matching file
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets s
+		WHERE expires > NOW() AND (($1 <> 0 AND user_id = $1) OR (visibility = 'public' AND max_views = 0 AND password_hash IS NULL AND NOT encrypted))
+		AND (title_tsv @@ to_tsquery('simple', $2) OR EXISTS (SELECT 1 FROM snippet_files f
+			WHERE f.snippet_id = s.id AND f.tsv @@ to_tsquery('simple', $2)))
+		ORDER BY ts_rank(title_tsv, to_tsquery('simple', $2)) + COALESCE((SELECT MAX(ts_rank(f.tsv, to_tsquery('simple', $2)))
+			FROM snippet_files f WHERE f.snippet_id = s.id AND f.tsv @@ to_tsquery('simple', $2)), 0) DESC, created DESC, id DESC
+		LIMIT $3 OFFSET $4`
+	rows, err := m.DB.QueryContext(ctx, stmt, viewerID, match, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := sqlstore.ScanSnippets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are needed to show an excerpt of each result
+	return snippets, dialect.WithFiles(ctx, m.DB, snippets...)
+}
+
+// To turn a search typed by a user into a tsquery matching any of its words, like the natural language mode of MySQL.
+// Only the letters and digits are kept, so the tsquery operators typed by the user can't change the query
+func tsQuery(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " | ")
+}
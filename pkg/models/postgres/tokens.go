@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"snippet-box/pkg/models"
+	"snippet-box/pkg/models/internal/sqlstore"
+	"strings"
+)
+
+// To define a TokenModel type that wraps a sql.DB connection pool, for the personal API tokens
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// To create a new API token for a user, with a name and scopes. It returns the token, only its hash is stored
+func (m *TokenModel) Insert(ctx context.Context, userID int, name string, scopes []string) (string, error) {
+	token, hash, err := models.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	// The scopes are stored as a comma separated list, e.g. "read,write"
+	stmt := `INSERT INTO api_tokens (user_id, name, scopes, token_hash, created) VALUES ($1, $2, $3, $4, NOW())`
+	_, err = m.DB.ExecContext(ctx, stmt, userID, name, strings.Join(scopes, ","), hash)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// To return the API tokens of a user, newest first
+func (m *TokenModel) ByUser(ctx context.Context, userID int) ([]*models.Token, error) {
+	stmt := `SELECT ` + sqlstore.TokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY created DESC, id DESC`
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	return sqlstore.ScanTokens(rows)
+}
+
+// To revoke an API token of a user, returning ErrNoRecord when the user has no token with this ID
+func (m *TokenModel) Revoke(ctx context.Context, id, userID int) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// To return the API token matching the token given in a request, or ErrInvalidCredentials when there is none
+func (m *TokenModel) Authenticate(ctx context.Context, token string) (*models.Token, error) {
+	stmt := `SELECT ` + sqlstore.TokenColumns + ` FROM api_tokens WHERE token_hash = $1`
+	t, err := sqlstore.ScanToken(m.DB.QueryRowContext(ctx, stmt, models.HashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
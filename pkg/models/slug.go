@@ -0,0 +1,34 @@
+package models
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// The alphabet and length of snippet slugs, 62^10 possible values make them unguessable
+const (
+	slugAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	slugLength   = 10
+)
+
+// To generate a new random base62 slug for a snippet.
+// A slug made only of digits is never returned, so slugs can't be mistaken for the old integer IDs
+func NewSlug() (string, error) {
+	max := big.NewInt(int64(len(slugAlphabet)))
+	b := make([]byte, slugLength)
+
+	for {
+		for i := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			b[i] = slugAlphabet[n.Int64()]
+		}
+
+		if strings.Trim(string(b), "0123456789") != "" {
+			return string(b), nil
+		}
+	}
+}
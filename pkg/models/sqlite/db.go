@@ -0,0 +1,34 @@
+// Package sqlite stores the snippets, users and API tokens in a SQLite database file, with the same semantics as the
+// MySQL backend. It uses a pure Go SQLite driver, so it needs neither cgo nor a database server
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The settings every connection needs: foreign keys, waiting for the lock instead of failing at once, the write ahead
+// log so readers don't block the writer, and times written in a format SQLite can compare and read back
+const dsnParams = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+
+// To open the database file in the DSN, e.g. "file:snippetbox.db", adding the settings of dsnParams to it
+func Open(dsn string) (*sql.DB, error) {
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + dsnParams
+	} else {
+		dsn += "?" + dsnParams
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes the writes, SQLite only allows one writer at a time and has no row locks
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,379 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"snippet-box/pkg/models"
+	"snippet-box/pkg/models/internal/sqlstore"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// To define a SnippetModel type that wraps a sql.DB connection pool
+type SnippetModel struct {
+	DB *sql.DB
+}
+
+// The number of times Insert tries a new random slug when the generated one is already taken
+const slugAttempts = 5
+
+// The dialect of the statements shared with the other SQL backends
+var dialect = sqlstore.QuestionMarks
+
+// To insert a new snippet into the database, along with its files and first revision. The UserID, Title, Files, Visibility,
+// MaxViews, HashedPassword and Encrypted fields of s are saved, and the snippet expires in the given number of days.
+// A UserID of 0 makes an anonymous snippet, which nobody owns.
+// It returns the random slug identifying the new snippet
+func (m *SnippetModel) Insert(ctx context.Context, s *models.Snippet, expires int) (string, error) {
+	// To run all the inserts in a transaction, so a snippet never exists without its files and history
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// The SQL statement to be executed, the times are computed in Go as SQLite has no date type
+	stmt := `INSERT INTO snippets (slug, user_id, title, visibility, max_views, views, password_hash, encrypted, created, expires)
+		 VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)`
+	created := now()
+
+	var slug string
+	var result sql.Result
+	for i := 0; i < slugAttempts; i++ {
+		slug, err = models.NewSlug()
+		if err != nil {
+			return "", err
+		}
+		// To execute the statement, trying again with another slug if this one collides with an existing snippet
+		result, err = tx.ExecContext(ctx, stmt, slug, sqlstore.NullID(s.UserID), s.Title, s.Visibility, s.MaxViews, s.HashedPassword, s.Encrypted,
+			created, created.AddDate(0, 0, expires))
+		if !isDuplicate(err, "snippets.slug") {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// To get the ID of the newly inserted record in the snippets table
+	id, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	// The ID returned has the type int64, so it is converted to an int type
+	err = dialect.InsertFiles(ctx, tx, sqlstore.SnippetFiles, "snippet_id", int(id), s.Files)
+	if err != nil {
+		return "", err
+	}
+	err = insertRevision(ctx, tx, int(id), s.UserID, s.Title, s.Files)
+	if err != nil {
+		return "", err
+	}
+
+	return slug, tx.Commit()
+}
+
+// To save the Title, Files and Visibility fields of an existing snippet and keep the result as a new revision
+// saved by the user with editorID. An expires value of 0 keeps the current expiry date
+func (m *SnippetModel) Update(ctx context.Context, s *models.Snippet, editorID, expires int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = ?, visibility = ?,
+		expires = CASE WHEN ? = 0 THEN expires ELSE ? END WHERE id = ?`
+	_, err = tx.ExecContext(ctx, stmt, s.Title, s.Visibility, expires, now().AddDate(0, 0, expires), s.ID)
+	if err != nil {
+		return err
+	}
+
+	// The files are replaced as a whole, the previous ones are still kept in the revisions
+	_, err = tx.ExecContext(ctx, `DELETE FROM snippet_files WHERE snippet_id = ?`, s.ID)
+	if err != nil {
+		return err
+	}
+	err = dialect.InsertFiles(ctx, tx, sqlstore.SnippetFiles, "snippet_id", s.ID, s.Files)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, s.ID, editorID, s.Title, s.Files)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// To permanently remove a snippet and its revisions from the database
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = dialect.DeleteSnippet(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// To permanently remove up to limit expired snippets, the ones which expired first, with their files and revisions.
+// It returns how many snippets were removed, fewer than limit once there is no expired snippet left
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT id FROM snippets WHERE expires <= ? ORDER BY expires LIMIT ?`
+	rows, err := tx.QueryContext(ctx, stmt, now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err = dialect.DeleteSnippet(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// To fetch a snippet by its slug for reading its content, with the same visibility rules as Get.
+// Views by anyone but the owner are counted, and a snippet with a view limit is deleted in the same transaction
+// as its last allowed view, so it can never be read more times than its limit. SQLite has no row locks, the views
+// are counted one after the other because Open gives the pool a single connection
+func (m *SnippetModel) View(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > ? AND slug = ?`
+	s, err := sqlstore.ScanSnippet(tx.QueryRowContext(ctx, stmt, now(), slug))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	// The files are read before the last view of a burn after reading snippet deletes them
+	err = dialect.WithFiles(ctx, tx, s)
+	if err != nil {
+		return nil, err
+	}
+	if s.MaxViews == 0 || s.OwnedBy(viewerID) {
+		return s, nil
+	}
+
+	s.Views++
+	if s.Burned() {
+		err = dialect.DeleteSnippet(ctx, tx, s.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE snippets SET views = ? WHERE id = ?`, s.Views, s.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, tx.Commit()
+}
+
+// To return every revision of a snippet with its files, oldest first, with the name of the user who saved it
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*models.Revision, error) {
+	return dialect.Revisions(ctx, m.DB, id)
+}
+
+// To record a snapshot of a snippet's title and files in the snippet_revisions and snippet_revision_files tables
+func insertRevision(ctx context.Context, tx *sql.Tx, snippetID, userID int, title string, files []*models.File) error {
+	stmt := `INSERT INTO snippet_revisions (snippet_id, user_id, title, created)
+		VALUES (?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt, snippetID, sqlstore.NullID(userID), title, now())
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	return dialect.InsertFiles(ctx, tx, sqlstore.RevisionFiles, "revision_id", int(id), files)
+}
+
+// To fetch a specific snippet by its slug, with the same visibility rules as Get
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string, viewerID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > ? AND slug = ?`
+	s, err := sqlstore.ScanSnippet(m.DB.QueryRowContext(ctx, stmt, now(), slug))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	return s, dialect.WithFiles(ctx, m.DB, s)
+}
+
+// To fetch a specific snippet by ID, as seen by the user with viewerID (0 for anonymous users).
+// Private snippets of other users are reported as not found, so their existence isn't revealed
+func (m *SnippetModel) Get(ctx context.Context, id, viewerID int) (*models.Snippet, error) {
+	stmt := `SELECT ` + sqlstore.SnippetColumns + ` FROM snippets WHERE expires > ? and id = ?`
+	// To execute the SQL statement with the QueryRow method on the connection pool
+	row := m.DB.QueryRowContext(ctx, stmt, now(), id)
+	// To copy the values from each field in sql.Row to a new snippet struct
+	s, err := sqlstore.ScanSnippet(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !s.VisibleTo(viewerID) {
+		return nil, models.ErrNoRecord
+	}
+
+	// If everything goes OK then return the Snippet object, along with its files
+	return s, dialect.WithFiles(ctx, m.DB, s)
+}
+
+// To return one page of the unexpired snippets matching the filter, newest first, using keyset pagination on (created, id)
+func (m *SnippetModel) List(ctx context.Context, filter models.SnippetFilter) (*models.SnippetPage, error) {
+	// To build the WHERE clause from the conditions set in the filter, only public snippets are listed unless they belong to the viewer
+	t := now()
+	where := []string{"expires > ?", "(visibility = 'public' OR (? <> 0 AND user_id = ?))"}
+	args := []interface{}{t, filter.ViewerID, filter.ViewerID}
+
+	if filter.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, "created >= ?")
+		args = append(args, filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, "created < ?")
+		args = append(args, filter.CreatedTo)
+	}
+	if filter.ExpiresWithin > 0 {
+		where = append(where, "expires <= ?")
+		args = append(args, t.Add(filter.ExpiresWithin))
+	}
+
+	// Paging back means reading the newer rows in ascending order, they are put back in order by NewSnippetPage
+	order := "DESC"
+	if c := filter.After; c != nil {
+		where = append(where, "(created < ? OR (created = ? AND id < ?))")
+		args = append(args, c.Created, c.Created, c.ID)
+	} else if c := filter.Before; c != nil {
+		where = append(where, "(created > ? OR (created = ? AND id > ?))")
+		args = append(args, c.Created, c.Created, c.ID)
+		order = "ASC"
+	}
+
+	// One more row than needed is fetched to know if there is another page
+	stmt := fmt.Sprintf(`SELECT `+sqlstore.SnippetColumns+` FROM snippets
+		WHERE %s ORDER BY created %s, id %s LIMIT ?`, strings.Join(where, " AND "), order, order)
+	args = append(args, filter.Limit+1)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := sqlstore.ScanSnippets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewSnippetPage(filter, snippets), nil
+}
+
+// To search the title and files of the unexpired snippets, best matches first, using the FTS5 tables indexing the titles
+// and the names and content of the files.
+// Like listings, only public snippets are searched, plus those belonging to the viewer. Snippets with a view limit
+// or a password are left out, as the search excerpts would show their content without a counted view or an unlock,
+// and so are the encrypted snippets since their content is only ciphertext
+func (m *SnippetModel) Search(ctx context.Context, query string, viewerID, limit, offset int) ([]*models.Snippet, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return []*models.Snippet{}, nil
+	}
+
+	// The score of a snippet is the score of its title plus the one of its best matching file. bm25 scores are
+	// negative, the better matches being the lower ones, and can only be read in the query doing the MATCH, which the
+	// MATERIALIZED keyword keeps from being merged into the outer query
+	stmt := `WITH title_hits AS MATERIALIZED (
+			SELECT rowid AS snippet_id, bm25(snippets_fts) AS score FROM snippets_fts WHERE snippets_fts MATCH ?
+		), file_matches AS MATERIALIZED (
+			SELECT rowid AS file_id, bm25(snippet_files_fts) AS score FROM snippet_files_fts WHERE snippet_files_fts MATCH ?
+		), file_hits AS (
+			SELECT f.snippet_id, MIN(m.score) AS score FROM snippet_files f JOIN file_matches m ON m.file_id = f.id GROUP BY f.snippet_id
+		)
+		SELECT ` + sqlstore.SnippetColumns + ` FROM snippets s
+		LEFT JOIN title_hits t ON t.snippet_id = s.id LEFT JOIN file_hits fh ON fh.snippet_id = s.id
+		WHERE (t.snippet_id IS NOT NULL OR fh.snippet_id IS NOT NULL)
+		AND expires > ? AND ((? <> 0 AND user_id = ?) OR (visibility = 'public' AND max_views = 0 AND password_hash IS NULL AND NOT encrypted))
+		ORDER BY COALESCE(t.score, 0) + COALESCE(fh.score, 0), created DESC, id DESC
+		LIMIT ? OFFSET ?`
+	rows, err := m.DB.QueryContext(ctx, stmt, match, match, now(), viewerID, viewerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := sqlstore.ScanSnippets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files are needed to show an excerpt of each result
+	return snippets, dialect.WithFiles(ctx, m.DB, snippets...)
+}
+
+// To turn a search typed by a user into an FTS5 query matching any of its words, like the natural language mode of
+// MySQL. Each word is quoted, so the FTS5 operators typed by the user are searched as plain words
+func ftsQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " OR ")
+}
+
+// To return the current time, the times are all stored in UTC so they compare in order. The tests replace it to
+// control the clock
+var now = func() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"snippet-box/pkg/migrations"
+	"snippet-box/pkg/models/internal/storetest"
+	"testing"
+	"time"
+)
+
+func TestStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *storetest.Backend {
+		db, err := Open("file:" + filepath.Join(t.TempDir(), "snippetbox.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := migrations.New(db, "sqlite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		realNow := now
+		t.Cleanup(func() { now = realNow })
+		return &storetest.Backend{
+			Snippets: &SnippetModel{DB: db},
+			Users:    &UserModel{DB: db},
+			Tokens:   &TokenModel{DB: db},
+			SetNow:   func(t time.Time) { now = func() time.Time { return t } },
+		}
+	})
+}
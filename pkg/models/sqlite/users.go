@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"snippet-box/pkg/models"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type UserModel struct {
+	DB *sql.DB
+}
+
+// To add a new record to the users table in the DB
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
+	// To Create a bcrypt hash of the password text
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, ?)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword), now())
+	if isDuplicate(err, "users.email") {
+		return models.ErrDuplicateEmail
+	}
+	return err
+}
+
+// To check if err is a SQLite "UNIQUE constraint failed" error for the given column. SQLite names the table and column
+// in the message, e.g. "UNIQUE constraint failed: users.email", rather than the constraint
+func isDuplicate(err error, column string) bool {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteErr.Error(), column)
+	}
+	return false
+}
+
+// To verify if user exist, and return user ID if user exist
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	// To retrieve the user id and hashed password
+	var id int
+	var hashedPassword []byte
+	row := m.DB.QueryRowContext(ctx, "SELECT id, hashed_password FROM users WHERE email = ?", email)
+	err := row.Scan(&id, &hashedPassword)
+	if err == sql.ErrNoRows {
+		return 0, models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	// To check if the hashed password and password text matches
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, models.ErrInvalidCredentials
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Otherwise the password is correct, return the user id
+	return id, nil
+}
+
+// To get the details of a specific user
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
+	s := &models.User{}
+
+	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&s.ID, &s.Name, &s.Email, &s.Created)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNoRecord
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import "context"
+
+// The storage of the snippets, with their files and revisions. The handlers only depend on this interface, it is
+// implemented for each database in the packages under pkg/models, and in memory by pkg/models/memory.
+// Expired snippets are never returned, and private snippets are only returned to their owner
+type SnippetStore interface {
+	// To save a new snippet expiring in the given number of days, returning its random slug
+	Insert(ctx context.Context, s *Snippet, expires int) (string, error)
+	// To save the Title, Files and Visibility of a snippet as a new revision by editorID, an expires of 0 keeps the expiry date
+	Update(ctx context.Context, s *Snippet, editorID, expires int) error
+	// To permanently remove a snippet and its revisions
+	Delete(ctx context.Context, id int) error
+	// To permanently remove up to limit expired snippets with their revisions, returning how many were removed
+	DeleteExpired(ctx context.Context, limit int) (int, error)
+	// To read a snippet, counting the view and deleting a burn after reading snippet on its last allowed view
+	View(ctx context.Context, slug string, viewerID int) (*Snippet, error)
+	// To return every revision of a snippet, oldest first
+	Revisions(ctx context.Context, id int) ([]*Revision, error)
+	// To fetch a snippet by its slug without counting a view
+	GetBySlug(ctx context.Context, slug string, viewerID int) (*Snippet, error)
+	// To fetch a snippet by its integer ID without counting a view
+	Get(ctx context.Context, id, viewerID int) (*Snippet, error)
+	// To return one page of the snippets matching the filter, newest first, without their files
+	List(ctx context.Context, filter SnippetFilter) (*SnippetPage, error)
+	// To search the titles and files of the public snippets and of the viewer's own, best matches first
+	Search(ctx context.Context, query string, viewerID, limit, offset int) ([]*Snippet, error)
+}
+
+// The storage of the user accounts
+type UserStore interface {
+	// To add a new user, returning ErrDuplicateEmail when the email address is already used
+	Insert(ctx context.Context, name, email, password string) error
+	// To return the ID of the user with this email address and password, or ErrInvalidCredentials
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	// To fetch a user by ID, without the password hash
+	Get(ctx context.Context, id int) (*User, error)
+}
+
+// The storage of the personal API tokens, which only keeps their hashes
+type TokenStore interface {
+	// To create a new token for a user, returning the token
+	Insert(ctx context.Context, userID int, name string, scopes []string) (string, error)
+	// To return the tokens of a user, newest first
+	ByUser(ctx context.Context, userID int) ([]*Token, error)
+	// To revoke a token of a user, returning ErrNoRecord when the user has no token with this ID
+	Revoke(ctx context.Context, id, userID int) error
+	// To return the token matching the one given in a request, or ErrInvalidCredentials
+	Authenticate(ctx context.Context, token string) (*Token, error)
+}
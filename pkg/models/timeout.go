@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is returned, wrapped with the error of the store, when a call to a store didn't finish within its timeout.
+// It matches context.DeadlineExceeded with errors.Is too
+var ErrTimeout = fmt.Errorf("models: store call timed out: %w", context.DeadlineExceeded)
+
+// To run a call to a store with a deadline, so a slow database can't hold a request for longer than the timeout.
+// Some drivers report an interrupted query with an error of their own, so any error once the deadline has passed is
+// reported as ErrTimeout. A timeout of 0 leaves the context as it is
+func withTimeout[T any](ctx context.Context, timeout time.Duration, call func(context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return call(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	v, err := call(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if err == context.DeadlineExceeded {
+			err = ErrTimeout
+		} else if !errors.Is(err, ErrTimeout) {
+			err = fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+	}
+	return v, err
+}
+
+// To run a call returning only an error with withTimeout
+func withTimeoutErr(ctx context.Context, timeout time.Duration, call func(context.Context) error) error {
+	_, err := withTimeout(ctx, timeout, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, call(ctx)
+	})
+	return err
+}
+
+// To wrap a SnippetStore so each call has the timeout
+func SnippetStoreWithTimeout(s SnippetStore, timeout time.Duration) SnippetStore {
+	return &timeoutSnippets{s, timeout}
+}
+
+// To wrap a UserStore so each call has the timeout
+func UserStoreWithTimeout(s UserStore, timeout time.Duration) UserStore {
+	return &timeoutUsers{s, timeout}
+}
+
+// To wrap a TokenStore so each call has the timeout
+func TokenStoreWithTimeout(s TokenStore, timeout time.Duration) TokenStore {
+	return &timeoutTokens{s, timeout}
+}
+
+type timeoutSnippets struct {
+	store   SnippetStore
+	timeout time.Duration
+}
+
+func (t *timeoutSnippets) Insert(ctx context.Context, s *Snippet, expires int) (string, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (string, error) {
+		return t.store.Insert(ctx, s, expires)
+	})
+}
+
+func (t *timeoutSnippets) Update(ctx context.Context, s *Snippet, editorID, expires int) error {
+	return withTimeoutErr(ctx, t.timeout, func(ctx context.Context) error {
+		return t.store.Update(ctx, s, editorID, expires)
+	})
+}
+
+func (t *timeoutSnippets) Delete(ctx context.Context, id int) error {
+	return withTimeoutErr(ctx, t.timeout, func(ctx context.Context) error {
+		return t.store.Delete(ctx, id)
+	})
+}
+
+func (t *timeoutSnippets) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (int, error) {
+		return t.store.DeleteExpired(ctx, limit)
+	})
+}
+
+func (t *timeoutSnippets) View(ctx context.Context, slug string, viewerID int) (*Snippet, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*Snippet, error) {
+		return t.store.View(ctx, slug, viewerID)
+	})
+}
+
+func (t *timeoutSnippets) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) ([]*Revision, error) {
+		return t.store.Revisions(ctx, id)
+	})
+}
+
+func (t *timeoutSnippets) GetBySlug(ctx context.Context, slug string, viewerID int) (*Snippet, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*Snippet, error) {
+		return t.store.GetBySlug(ctx, slug, viewerID)
+	})
+}
+
+func (t *timeoutSnippets) Get(ctx context.Context, id, viewerID int) (*Snippet, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*Snippet, error) {
+		return t.store.Get(ctx, id, viewerID)
+	})
+}
+
+func (t *timeoutSnippets) List(ctx context.Context, filter SnippetFilter) (*SnippetPage, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*SnippetPage, error) {
+		return t.store.List(ctx, filter)
+	})
+}
+
+func (t *timeoutSnippets) Search(ctx context.Context, query string, viewerID, limit, offset int) ([]*Snippet, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) ([]*Snippet, error) {
+		return t.store.Search(ctx, query, viewerID, limit, offset)
+	})
+}
+
+type timeoutUsers struct {
+	store   UserStore
+	timeout time.Duration
+}
+
+func (t *timeoutUsers) Insert(ctx context.Context, name, email, password string) error {
+	return withTimeoutErr(ctx, t.timeout, func(ctx context.Context) error {
+		return t.store.Insert(ctx, name, email, password)
+	})
+}
+
+func (t *timeoutUsers) Authenticate(ctx context.Context, email, password string) (int, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (int, error) {
+		return t.store.Authenticate(ctx, email, password)
+	})
+}
+
+func (t *timeoutUsers) Get(ctx context.Context, id int) (*User, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*User, error) {
+		return t.store.Get(ctx, id)
+	})
+}
+
+type timeoutTokens struct {
+	store   TokenStore
+	timeout time.Duration
+}
+
+func (t *timeoutTokens) Insert(ctx context.Context, userID int, name string, scopes []string) (string, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (string, error) {
+		return t.store.Insert(ctx, userID, name, scopes)
+	})
+}
+
+func (t *timeoutTokens) ByUser(ctx context.Context, userID int) ([]*Token, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) ([]*Token, error) {
+		return t.store.ByUser(ctx, userID)
+	})
+}
+
+func (t *timeoutTokens) Revoke(ctx context.Context, id, userID int) error {
+	return withTimeoutErr(ctx, t.timeout, func(ctx context.Context) error {
+		return t.store.Revoke(ctx, id, userID)
+	})
+}
+
+func (t *timeoutTokens) Authenticate(ctx context.Context, token string) (*Token, error) {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) (*Token, error) {
+		return t.store.Authenticate(ctx, token)
+	})
+}
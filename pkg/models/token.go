@@ -0,0 +1,60 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+// The scopes an API token can be given, each one allows a kind of request
+const (
+	ScopeRead   = "read"   // Reading snippets, including the private ones of the token owner, and the owner's account
+	ScopeWrite  = "write"  // Creating and changing snippets
+	ScopeDelete = "delete" // Deleting snippets
+)
+
+// The scopes in the order they are shown
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeDelete}
+
+// A personal API token. The token itself is only shown once, when it is created, as only its hash is stored
+type Token struct {
+	ID      int
+	UserID  int
+	Name    string // Given by the user, to remember where the token is used
+	Scopes  []string
+	Created time.Time
+}
+
+// To check if the token was given a scope
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// The prefix of the API tokens, so they are easy to recognise, e.g. by secret scanners
+const tokenPrefix = "sbx_"
+
+// To generate a new random API token. It returns the token, which is only ever shown to its owner, and the hash of it
+// which is kept in the database
+func NewToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// To hash an API token to look it up in the database. Tokens are long random values, so unlike passwords they don't
+// need a slow hash like bcrypt
+func HashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -5,4 +5,199 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// End-to-end encrypted snippets: the content is encrypted in the browser with AES-GCM before the form is sent,
+// and the key only ever lives in the URL fragment, which browsers never send to the server
+var snippetCrypto = {
+	// To encode bytes as standard base64, used for the ciphertext stored by the server
+	toBase64: function (bytes) {
+		var binary = "";
+		for (var i = 0; i < bytes.length; i++) {
+			binary += String.fromCharCode(bytes[i]);
+		}
+		return btoa(binary);
+	},
+
+	fromBase64: function (text) {
+		var binary = atob(text);
+		var bytes = new Uint8Array(binary.length);
+		for (var i = 0; i < binary.length; i++) {
+			bytes[i] = binary.charCodeAt(i);
+		}
+		return bytes;
+	},
+
+	// To encode the key for the URL fragment (base64url without padding)
+	keyToFragment: function (rawKey) {
+		return snippetCrypto.toBase64(new Uint8Array(rawKey)).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	},
+
+	// To read the key from the URL fragment, returns null when there is none
+	keyFromFragment: function () {
+		var fragment = window.location.hash.slice(1);
+		return Promise.resolve().then(function () {
+			if (!fragment) {
+				return null;
+			}
+			var raw = snippetCrypto.fromBase64(fragment.replace(/-/g, "+").replace(/_/g, "/"));
+			return crypto.subtle.importKey("raw", raw, "AES-GCM", true, ["encrypt", "decrypt"]);
+		});
+	},
+
+	newKey: function () {
+		return crypto.subtle.generateKey({name: "AES-GCM", length: 256}, true, ["encrypt", "decrypt"]);
+	},
+
+	// The ciphertext is the base64 encoding of the 12 byte IV followed by the AES-GCM output
+	encrypt: function (key, text) {
+		var iv = crypto.getRandomValues(new Uint8Array(12));
+		return crypto.subtle.encrypt({name: "AES-GCM", iv: iv}, key, new TextEncoder().encode(text)).then(function (encrypted) {
+			var out = new Uint8Array(iv.length + encrypted.byteLength);
+			out.set(iv);
+			out.set(new Uint8Array(encrypted), iv.length);
+			return snippetCrypto.toBase64(out);
+		});
+	},
+
+	decrypt: function (key, ciphertext) {
+		var bytes = snippetCrypto.fromBase64(ciphertext.trim());
+		return crypto.subtle.decrypt({name: "AES-GCM", iv: bytes.slice(0, 12)}, key, bytes.slice(12)).then(function (decrypted) {
+			return new TextDecoder().decode(decrypted);
+		});
+	}
+};
+
+// To decrypt the files of an encrypted snippet on the show page
+var encryptedCodes = document.querySelectorAll("code.encrypted");
+if (encryptedCodes.length > 0) {
+	snippetCrypto.keyFromFragment().then(function (key) {
+		if (!key) {
+			throw new Error("missing key");
+		}
+		return Promise.all(Array.prototype.map.call(encryptedCodes, function (code) {
+			return snippetCrypto.decrypt(key, code.textContent);
+		}));
+	}).then(function (texts) {
+		for (var i = 0; i < encryptedCodes.length; i++) {
+			encryptedCodes[i].textContent = texts[i];
+			encryptedCodes[i].classList.remove("encrypted");
+		}
+	}).catch(function () {
+		for (var i = 0; i < encryptedCodes.length; i++) {
+			encryptedCodes[i].textContent = "This snippet is encrypted and the key in the link is missing or wrong.";
+		}
+	});
+
+	// The links to pages which need the content (like the edit form) keep the key
+	var keyLinks = document.querySelectorAll("a.keep-key");
+	for (var j = 0; j < keyLinks.length; j++) {
+		keyLinks[j].href += window.location.hash;
+	}
+}
+
+// The create and edit forms: the files are added and removed in the page, and encrypted before the form is sent
+var snippetForm = document.querySelector("form.snippet-form");
+if (snippetForm) {
+	var encryptInput = snippetForm.querySelector("input[name='encrypted']");
+	var contents = function () {
+		return Array.prototype.slice.call(snippetForm.querySelectorAll("textarea[name='content']"));
+	};
+	var formKey = null;
+
+	// The add and remove buttons also work without JavaScript, by sending the form to be redisplayed by the server.
+	// Doing it in the page never sends the content of an encrypted snippet unencrypted
+	var files = snippetForm.querySelector(".files");
+	files.addEventListener("click", function (event) {
+		var fieldsets = files.querySelectorAll("fieldset.file");
+		if (event.target.name === "add_file") {
+			event.preventDefault();
+			var file = fieldsets[fieldsets.length - 1].cloneNode(true);
+			var fields = file.querySelectorAll("input, textarea");
+			for (var i = 0; i < fields.length; i++) {
+				fields[i].value = "";
+				fields[i].readOnly = false;
+			}
+			file.querySelector("select").value = "auto";
+			var errors = file.querySelectorAll(".error");
+			for (var e = 0; e < errors.length; e++) {
+				errors[e].remove();
+			}
+			files.insertBefore(file, event.target);
+		} else if (event.target.name === "remove_file") {
+			event.preventDefault();
+			if (fieldsets.length > 1) {
+				event.target.closest("fieldset.file").remove();
+			}
+		}
+	});
+
+	// When editing an encrypted snippet, the current files are decrypted with the key from the link
+	if (encryptInput && encryptInput.type === "hidden") {
+		snippetCrypto.keyFromFragment().then(function (key) {
+			if (!key) {
+				throw new Error("missing key");
+			}
+			return Promise.all(contents().map(function (content) {
+				return snippetCrypto.decrypt(key, content.value);
+			})).then(function (texts) {
+				formKey = key;
+				contents().forEach(function (content, i) {
+					content.value = texts[i];
+				});
+			});
+		}).catch(function () {
+			// Without the key the ciphertext is sent back unchanged
+			contents().forEach(function (content) {
+				content.readOnly = true;
+			});
+		});
+	}
+
+	snippetForm.addEventListener("submit", function (event) {
+		var encrypt = encryptInput && (encryptInput.type === "hidden" ? formKey !== null : encryptInput.checked);
+		if (!encrypt) {
+			return;
+		}
+		event.preventDefault();
+
+		var keyPromise = formKey ? Promise.resolve(formKey) : snippetCrypto.newKey();
+		keyPromise.then(function (key) {
+			return Promise.all([
+				Promise.all(contents().map(function (content) {
+					return content.value ? snippetCrypto.encrypt(key, content.value) : "";
+				})),
+				crypto.subtle.exportKey("raw", key)
+			]);
+		}).then(function (results) {
+			contents().forEach(function (content, i) {
+				content.value = results[0][i];
+			});
+			// The key is put in the fragment of the form action, browsers keep it when following the redirect to the snippet
+			snippetForm.action = snippetForm.action.split("#")[0] + "#" + snippetCrypto.keyToFragment(results[1]);
+			snippetForm.submit();
+		});
+	});
+}
+
+// To switch the highlighted code between the light and dark themes, remembering the choice in the browser
+var highlighted = document.querySelectorAll(".highlight");
+if (highlighted.length > 0) {
+	var setTheme = function (theme) {
+		for (var i = 0; i < highlighted.length; i++) {
+			highlighted[i].classList.remove("theme-light", "theme-dark");
+			highlighted[i].classList.add(theme);
+		}
+		localStorage.setItem("highlight-theme", theme);
+	};
+
+	var prefersDark = window.matchMedia && window.matchMedia("(prefers-color-scheme: dark)").matches;
+	setTheme(localStorage.getItem("highlight-theme") || (prefersDark ? "theme-dark" : "theme-light"));
+
+	var toggles = document.querySelectorAll(".theme-toggle");
+	for (var t = 0; t < toggles.length; t++) {
+		toggles[t].addEventListener("click", function () {
+			setTheme(highlighted[0].classList.contains("theme-dark") ? "theme-light" : "theme-dark");
+		});
+	}
+}